@@ -0,0 +1,87 @@
+// cmd/config.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	config "github.com/majiayu000/gin-starter/configs"
+)
+
+const configUsage = `usage: %s [--config file] [--profile name] config <command>
+
+commands:
+  env                list the environment variable for every setting
+  print [--redacted] print the effective config after merging the profile
+                     and environment variables
+`
+
+// runConfigCommand runs a "config" subcommand and returns the exit code.
+// configPath and profile come from the global flags and can be overridden
+// after the subcommand name.
+func runConfigCommand(args []string, configPath, profile string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, configUsage, os.Args[0])
+		return 2
+	}
+
+	switch args[0] {
+	case "env":
+		printEnvVars(stdout)
+		return 0
+	case "print":
+		fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		redact := fs.Bool("redacted", false, "replace secrets with "+config.Secret("").String())
+		fs.StringVar(&configPath, "config", configPath, "path to the base config file")
+		fs.StringVar(&profile, "profile", profile, "config profile merged over the base file")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		return printConfig(stdout, stderr, configPath, profile, *redact)
+	default:
+		fmt.Fprintf(stderr, "unknown config command %q\n", args[0])
+		fmt.Fprintf(stderr, configUsage, os.Args[0])
+		return 2
+	}
+}
+
+// printEnvVars 输出环境变量与配置项的对应关系
+func printEnvVars(w io.Writer) {
+	fmt.Fprintf(w, "Every setting can be overridden with its environment variable, or read\n")
+	fmt.Fprintf(w, "from a file named by the same variable with a _FILE suffix.\n\n")
+
+	defaults := config.Defaults()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIABLE\tKEY\tTYPE\tDEFAULT")
+	for _, f := range config.Fields() {
+		value := ""
+		if d, ok := defaults[f.Key]; ok {
+			value = fmt.Sprint(d)
+		}
+		if f.Secret && value != "" {
+			value = config.Secret(value).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.EnvVar, f.Key, f.Type, value)
+	}
+	tw.Flush()
+}
+
+// printConfig 输出合并 profile 和环境变量之后实际生效的配置
+func printConfig(stdout, stderr io.Writer, configPath, profile string, redact bool) int {
+	cfg, err := config.LoadConfig(configPath, profile)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	out, err := cfg.YAML(redact)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to render config: %v\n", err)
+		return 1
+	}
+	stdout.Write(out)
+	return 0
+}
@@ -2,90 +2,209 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
-	"log"
-	"path/filepath"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/redis"
-	"github.com/gin-gonic/gin"
 	config "github.com/majiayu000/gin-starter/configs"
 
-	"github.com/majiayu000/gin-starter/internal/auth"
-	"github.com/majiayu000/gin-starter/internal/auth/oauth"
-	"github.com/majiayu000/gin-starter/internal/handlers"
+	"github.com/majiayu000/gin-starter/internal/app"
+	"github.com/majiayu000/gin-starter/internal/health"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/tlsutil"
+	"github.com/majiayu000/gin-starter/internal/tracing"
 )
 
 func main() {
+	configPath := flag.String("config", "config.yaml", "path to the base config file")
+	profile := flag.String("profile", os.Getenv(config.ProfileEnvVar),
+		"config profile merged over the base file, e.g. prod for config.prod.yaml (default $"+config.ProfileEnvVar+")")
+	flag.Parse()
+
+	if flag.Arg(0) == "config" {
+		os.Exit(runConfigCommand(flag.Args()[1:], *configPath, *profile, os.Stdout, os.Stderr))
+	}
 
 	// 加载配置
-	cfg, err := config.LoadConfig("config.yaml")
+	cfg, err := config.LoadConfig(*configPath, *profile)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
-	fmt.Println("cfg is", cfg.OAuth.Apple)
-	keyPath := filepath.Join(".", cfg.OAuth.Apple.KeyPath)
-	fmt.Println("key path is", keyPath)
-	// privateKeyData, err := os.ReadFile(keyPath)
-	// if err != nil {
-	// 	log.Fatalf("无法读取私钥文件: %v", err)
-	// }
-	// privateKeyString := string(privateKeyData)
-	// fmt.Println("private key is", privateKeyString)
-
-	// 初始化 OAuthManager
-	oauthConfig := map[string]map[string]string{
-		"google": {
-			"client_id":     cfg.OAuth.Google.ClientID,
-			"client_secret": cfg.OAuth.Google.ClientSecret,
-			"redirect_url":  cfg.OAuth.Google.RedirectURL,
-		},
-		"apple": {
-			"client_id":    cfg.OAuth.Apple.ClientID,
-			"team_id":      cfg.OAuth.Apple.TeamID,
-			"key_id":       cfg.OAuth.Apple.KeyID,
-			"private_key":  cfg.OAuth.Apple.KeyPath,
-			"redirect_url": cfg.OAuth.Apple.RedirectURL,
-		},
-	}
-	fmt.Println("config is ", cfg.OAuth.Google.RedirectURL)
-	oauthManager := auth.NewOAuthManager()
-
-	store, _ := redis.NewStore(10, "tcp", "localhost:6379", "123456", []byte("secret"))
-	store.Options(sessions.Options{
-		MaxAge:   3600 * 24, // 24 小时
-		HttpOnly: true,
-		Secure:   true, // 如果使用 HTTPS
+		// 日志尚未初始化，直接输出，每个配置问题占一行
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	logLevel, err := logger.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		fatal("invalid log config", "error", err)
+	}
+	slog.SetDefault(logger.New(os.Stdout, logLevel, cfg.Log.Format))
+	slog.Debug("config loaded", "config", cfg)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		ServiceName: cfg.Tracing.ServiceName,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
 	})
-	sessionManager := auth.NewSessionManager("localhost:6379", "123456", 0)
-	googleProvider, _ := oauth.NewGoogleProvider(
-		oauthConfig["google"],
-		sessionManager,
-	)
-
-	appleProvider, _ := oauth.NewAppleProvider(
-		oauthConfig["apple"],
-		sessionManager,
-	)
-	fmt.Println(appleProvider)
-	oauthManager.AddProvider("google", googleProvider)
-	authHandler := handlers.NewAuthHandler(oauthManager, sessionManager)
-	r := gin.Default()
-
-	r.Use(sessions.Sessions("mysession", store))
-
-	r.GET("/", authHandler.HandleProfile)
-	r.GET("/auth/:provider/login", authHandler.HandleGoogleLogin)
-	r.GET("/auth/:provider/callback", authHandler.HandleGoogleCallback)
-	r.POST("/logout", authHandler.HandleLogout)
-
-	addr := fmt.Sprintf(":%d", cfg.Server.Port)
-	log.Printf("Starting server on %s", addr)
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
-	// log.Printf("Starting Server listening on localhost:8080")
-	// if err := r.Run(":8080"); err != nil {
-	// 	log.Fatal("Run: ", err)
-	// }
+	if err != nil {
+		fatal("failed to set up tracing", "error", err)
+	}
+
+	application, err := app.New(cfg)
+	if err != nil {
+		fatal("failed to initialize application", "error", err)
+	}
+	// OAuth 和限流配置支持热加载，其他配置修改后需要重启
+	config.Watch(cfg, *configPath, *profile, application.Reload)
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           application.Router(),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	servers := []*http.Server{srv}
+	var redirectSrv, metricsSrv *http.Server
+	var certReloader *tlsutil.CertReloader
+	if cfg.TLS.Enabled {
+		srv.TLSConfig, certReloader, err = newTLSConfig(cfg)
+		if err != nil {
+			fatal("failed to set up TLS", "error", err)
+		}
+		if cfg.TLS.RedirectPort != 0 {
+			redirectSrv = &http.Server{
+				Addr:              fmt.Sprintf(":%d", cfg.TLS.RedirectPort),
+				Handler:           tlsutil.RedirectHandler(cfg.Server.Port),
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+				IdleTimeout:       cfg.Server.IdleTimeout,
+			}
+			servers = append(servers, redirectSrv)
+		}
+	}
+	if cfg.Metrics.Enabled {
+		// 指标接口不需要认证，只在单独的端口上提供
+		metricsSrv = &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.Metrics.Port),
+			Handler:           application.MetricsRouter(),
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+		servers = append(servers, metricsSrv)
+	}
+	listeners := make([]net.Listener, len(servers))
+	for i, s := range servers {
+		if listeners[i], err = net.Listen("tcp", s.Addr); err != nil {
+			fatal("failed to start server", "addr", s.Addr, "error", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, len(servers))
+	for i, s := range servers {
+		go func(s *http.Server, l net.Listener) {
+			// 证书由 TLSConfig 提供，ServeTLS 不需要证书文件路径
+			if s.TLSConfig != nil {
+				serveErr <- s.ServeTLS(l, "", "")
+			} else {
+				serveErr <- s.Serve(l)
+			}
+		}(s, listeners[i])
+	}
+	application.Readiness.SetReady(true)
+	for i, s := range servers {
+		addr := listeners[i].Addr().String()
+		switch s {
+		case srv:
+			slog.Info("server started", "addr", addr, "tls", cfg.TLS.Enabled)
+		case redirectSrv:
+			slog.Info("redirecting HTTP to HTTPS", "addr", addr)
+		case metricsSrv:
+			slog.Info("serving metrics", "addr", addr)
+		}
+	}
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		// 任一服务器异常退出时也要停止其他服务器，并以非零状态退出，让进程管理器重启实例
+		slog.Error("server stopped unexpectedly", "error", err)
+		exitCode = 1
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	}
+	stop()
+	shutdown(application.Readiness, cfg.Server.ShutdownDelay, cfg.Server.ShutdownTimeout, servers...)
+	if certReloader != nil {
+		certReloader.Close()
+	}
+
+	// 请求处理完后再关闭依赖
+	application.Close()
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	slog.Info("server stopped")
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// shutdown takes the instance out of rotation, waits delay for the load
+// balancer to notice, then drains in-flight requests for at most timeout
+// before closing the remaining connections.
+func shutdown(readiness *health.Readiness, delay, timeout time.Duration, servers ...*http.Server) {
+	readiness.SetReady(false)
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("graceful shutdown timed out, closing connections", "addr", srv.Addr, "error", err)
+			srv.Close()
+		}
+	}
+}
+
+// newTLSConfig returns the TLS config for HTTPS. With certificate files the
+// returned reloader picks up renewed certificates and must be closed on
+// exit; with tls.self_signed it is nil.
+func newTLSConfig(cfg *config.Config) (*tls.Config, *tlsutil.CertReloader, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLS.SelfSigned {
+		slog.Warn("using a self-signed TLS certificate; only use this for local development")
+		cert, err := tlsutil.SelfSigned([]string{"localhost", "127.0.0.1", "::1"}, 365*24*time.Hour)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		return tlsConfig, nil, nil
+	}
+
+	reloader, err := tlsutil.NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig.GetCertificate = reloader.GetCertificate
+	return tlsConfig, reloader, nil
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -4,18 +4,25 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
 	OAuth struct {
+		// HTTPTimeout 限制对 provider 的每次 HTTP 调用
+		HTTPTimeout time.Duration `mapstructure:"http_timeout"`
+
 		Google struct {
+			// Enabled 为 false 时不注册该 provider，可通过热加载切换
+			Enabled      bool   `mapstructure:"enabled"`
 			ClientID     string `mapstructure:"client_id"`
-			ClientSecret string `mapstructure:"client_secret"`
+			ClientSecret Secret `mapstructure:"client_secret"`
 			RedirectURL  string `mapstructure:"redirect_url"`
 		} `mapstructure:"google"`
 		Apple struct {
+			Enabled     bool   `mapstructure:"enabled"`
 			ClientID    string `mapstructure:"client_id"`
 			TeamID      string `mapstructure:"team_id"`
 			KeyID       string `mapstructure:"key_id"`
@@ -25,36 +32,290 @@ type Config struct {
 	} `mapstructure:"oauth"`
 	Server struct {
 		Port int `mapstructure:"port"`
+		// ReadHeaderTimeout、ReadTimeout、WriteTimeout、IdleTimeout 对应 http.Server 的同名字段
+		ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+		ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+		WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+		IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+		// ShutdownDelay 是收到退出信号后、停止接受连接前等待负载均衡摘除实例的时间
+		ShutdownDelay time.Duration `mapstructure:"shutdown_delay"`
+		// ShutdownTimeout 是等待进行中请求完成的最长时间，超时后强制关闭连接
+		ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+		// TrustedProxies 是可信反向代理的 IP 或 CIDR，只有来自它们的 X-Forwarded-For
+		// 才会用于确定客户端 IP；为空时只使用连接的对端地址
+		TrustedProxies []string `mapstructure:"trusted_proxies"`
 	} `mapstructure:"server"`
+	RequestTimeout struct {
+		// Default 是每个请求的处理时间预算，超时返回 504，必须短于 server.write_timeout；
+		// 只有 server.write_timeout 为 0 时才能设为 0（不限制）
+		Default time.Duration `mapstructure:"default"`
+		// Groups 按路由组前缀（如 "/auth"）配置单独的预算；0 表示该组不设预算，
+		// 但连接仍受 server.write_timeout 限制
+		Groups map[string]time.Duration `mapstructure:"groups"`
+	} `mapstructure:"request_timeout"`
+	TLS struct {
+		// Enabled 为 true 时 server.port 提供 HTTPS
+		Enabled bool `mapstructure:"enabled"`
+		// CertFile 和 KeyFile 是 PEM 格式的证书和私钥，文件变化时自动重新加载
+		CertFile string `mapstructure:"cert_file"`
+		KeyFile  string `mapstructure:"key_file"`
+		// SelfSigned 在启动时生成自签名证书代替证书文件，仅用于本地开发
+		SelfSigned bool `mapstructure:"self_signed"`
+		// RedirectPort 监听 HTTP 并把请求重定向到 HTTPS，为 0 时不监听
+		RedirectPort int `mapstructure:"redirect_port"`
+		// HSTSMaxAge 为 0 时不发送 Strict-Transport-Security
+		HSTSMaxAge            time.Duration `mapstructure:"hsts_max_age"`
+		HSTSIncludeSubdomains bool          `mapstructure:"hsts_include_subdomains"`
+	} `mapstructure:"tls"`
+	Session struct {
+		// Store 选择会话存储："redis" 或 "memory"（仅用于测试和单节点开发）
+		Store string `mapstructure:"store"`
+		// IdleTimeout 是会话在无访问情况下的存活时间，每次访问都会顺延
+		IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+		// MaxLifetime 是会话从创建起的绝对最长存活时间，不会被顺延
+		MaxLifetime time.Duration `mapstructure:"max_lifetime"`
+		// TouchInterval 限制顺延的频率，避免每个请求都写 Redis
+		TouchInterval time.Duration `mapstructure:"touch_interval"`
+		// EncryptionKeys 是加密会话数据的 AES 密钥（base64 编码的 16/24/32 字节），
+		// 轮换时先加入新密钥并设为 ActiveKeyID，待旧数据过期后再移除旧密钥
+		EncryptionKeys []EncryptionKey `mapstructure:"encryption_keys"`
+		ActiveKeyID    string          `mapstructure:"active_key_id"`
+	} `mapstructure:"session"`
+	JWT struct {
+		Issuer     string        `mapstructure:"issuer"`
+		Audience   string        `mapstructure:"audience"`
+		AccessTTL  time.Duration `mapstructure:"access_ttl"`
+		RefreshTTL time.Duration `mapstructure:"refresh_ttl"`
+		// RefreshMaxLifetime 是 refresh token 族从登录起的最长存活时间，之后必须重新登录
+		RefreshMaxLifetime time.Duration `mapstructure:"refresh_max_lifetime"`
+		// SigningKeys 是 PKCS#8 PEM 格式的 P-256 私钥文件，全部发布在 JWKS 中
+		SigningKeys []SigningKey `mapstructure:"signing_keys"`
+		ActiveKeyID string       `mapstructure:"active_key_id"`
+	} `mapstructure:"jwt"`
+	Redis struct {
+		Addr     string `mapstructure:"addr"`
+		Password Secret `mapstructure:"password"`
+		DB       int    `mapstructure:"db"`
+		// PoolSize 为 0 时使用 go-redis 的默认值（每个 CPU 10 个连接）
+		PoolSize     int           `mapstructure:"pool_size"`
+		DialTimeout  time.Duration `mapstructure:"dial_timeout"`
+		ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+		WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	} `mapstructure:"redis"`
+	Database struct {
+		// DSN 为空时不连接数据库
+		Driver          string        `mapstructure:"driver"`
+		DSN             Secret        `mapstructure:"dsn"`
+		MaxOpenConns    int           `mapstructure:"max_open_conns"`
+		MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+		ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	} `mapstructure:"database"`
+	Search struct {
+		// URL 为空时禁用搜索
+		URL     string        `mapstructure:"url"`
+		APIKey  Secret        `mapstructure:"api_key"`
+		Index   string        `mapstructure:"index"`
+		Timeout time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"search"`
+	Cookie struct {
+		Domain string `mapstructure:"domain"`
+		// Secure 为 true 时 cookie 只通过 HTTPS 发送，生产环境应开启
+		Secure bool `mapstructure:"secure"`
+		// SameSite 可选 "lax"、"strict" 或 "none"（要求 Secure）
+		SameSite string `mapstructure:"same_site"`
+	} `mapstructure:"cookie"`
+	CORS struct {
+		// 默认策略；allowed_origins 为空时不启用 CORS
+		CORSPolicy `mapstructure:",squash"`
+		// Groups 按路由组前缀（如 "/admin"）配置策略，整体替换默认策略
+		Groups map[string]CORSPolicy `mapstructure:"groups"`
+	} `mapstructure:"cors"`
+	SecurityHeaders struct {
+		SecurityHeadersPolicy `mapstructure:",squash"`
+		// Groups 按路由组前缀配置策略，整体替换默认策略
+		Groups map[string]SecurityHeadersPolicy `mapstructure:"groups"`
+	} `mapstructure:"security_headers"`
+	CSRF struct {
+		// Secret 用于派生 CSRF token；为空时使用随机值，重启后客户端需重新获取 token
+		Secret Secret `mapstructure:"secret"`
+	} `mapstructure:"csrf"`
+	RateLimit struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Default 适用于没有单独配置的路由
+		Default RateLimitPolicy `mapstructure:"default"`
+		// Routes 按路由模板（如 "/auth/:provider/login"）配置单独的策略
+		Routes []RouteRateLimit `mapstructure:"routes"`
+		// FailedAuth 限制每个 IP 提交无效 bearer token 或个人访问令牌的次数，by 只能为 "ip"
+		FailedAuth RateLimitPolicy `mapstructure:"failed_auth"`
+	} `mapstructure:"rate_limit"`
+	Health struct {
+		// CheckTimeout 是 /readyz 中每项依赖检查的超时时间
+		CheckTimeout time.Duration `mapstructure:"check_timeout"`
+	} `mapstructure:"health"`
+	Metrics struct {
+		// Enabled 控制是否开放 /metrics
+		Enabled bool `mapstructure:"enabled"`
+		// Port 是单独提供 /metrics 的 HTTP 端口，该接口不需要认证，不应对公网开放
+		Port int `mapstructure:"port"`
+	} `mapstructure:"metrics"`
+	Tracing struct {
+		// Exporter 可选 "none"、"stdout" 或 "otlp"（OTLP/HTTP）
+		Exporter    string `mapstructure:"exporter"`
+		ServiceName string `mapstructure:"service_name"`
+		// Endpoint 是 collector 的 host:port，为空时读取 OTEL_EXPORTER_OTLP_ENDPOINT
+		Endpoint    string  `mapstructure:"endpoint"`
+		Insecure    bool    `mapstructure:"insecure"`
+		SampleRatio float64 `mapstructure:"sample_ratio"`
+	} `mapstructure:"tracing"`
+	Log struct {
+		// Level 可选 "debug"、"info"、"warn" 或 "error"
+		Level string `mapstructure:"level"`
+		// Format 可选 "json" 或 "text"（适合本地开发）
+		Format string `mapstructure:"format"`
+	} `mapstructure:"log"`
+	PAT struct {
+		// MaxLifetime 是个人访问令牌的最长有效期
+		MaxLifetime time.Duration `mapstructure:"max_lifetime"`
+	} `mapstructure:"pat"`
+	Admin struct {
+		// Emails 是可以访问 /admin 接口的用户邮箱，必须经过 provider 验证，为空时所有人都无权访问
+		Emails []string `mapstructure:"emails"`
+	} `mapstructure:"admin"`
+}
+
+type EncryptionKey struct {
+	ID  string `mapstructure:"id"`
+	Key Secret `mapstructure:"key"`
+}
+
+type SigningKey struct {
+	ID      string `mapstructure:"id"`
+	KeyPath string `mapstructure:"key_path"`
 }
 
-func LoadConfig(configPath string) (*Config, error) {
-	viper.SetConfigFile(configPath)
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("..")
+type RateLimitPolicy struct {
+	Limit  int           `mapstructure:"limit"`
+	Window time.Duration `mapstructure:"window"`
+	// By 为 "ip" 或 "user"
+	By string `mapstructure:"by"`
+}
 
-	viper.AutomaticEnv()
-	viper.SetEnvPrefix("APP")
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+type CORSPolicy struct {
+	// AllowedOrigins 是完整的 origin，如 "https://app.example.com"，或 "*"
+	AllowedOrigins   []string `mapstructure:"allowed_origins"`
+	AllowCredentials bool     `mapstructure:"allow_credentials"`
+	// AllowedMethods 和 AllowedHeaders 为空时使用内置的默认值
+	AllowedMethods []string      `mapstructure:"allowed_methods"`
+	AllowedHeaders []string      `mapstructure:"allowed_headers"`
+	ExposedHeaders []string      `mapstructure:"exposed_headers"`
+	MaxAge         time.Duration `mapstructure:"max_age"`
+}
+
+// SecurityHeadersPolicy 中为空的字段不发送对应的响应头
+type SecurityHeadersPolicy struct {
+	ContentSecurityPolicy string `mapstructure:"content_security_policy"`
+	FrameOptions          string `mapstructure:"frame_options"`
+	ReferrerPolicy        string `mapstructure:"referrer_policy"`
+	PermissionsPolicy     string `mapstructure:"permissions_policy"`
+}
 
-	if err := viper.ReadInConfig(); err != nil {
+type RouteRateLimit struct {
+	Path            string `mapstructure:"path"`
+	RateLimitPolicy `mapstructure:",squash"`
+}
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.port", 8080)
+	v.SetDefault("server.read_header_timeout", 10*time.Second)
+	v.SetDefault("server.read_timeout", 30*time.Second)
+	v.SetDefault("server.write_timeout", 30*time.Second)
+	v.SetDefault("server.idle_timeout", 120*time.Second)
+	v.SetDefault("server.shutdown_delay", 5*time.Second)
+	v.SetDefault("server.shutdown_timeout", 25*time.Second)
+	// 留出余量，在 server.write_timeout 断开连接前返回 504
+	v.SetDefault("request_timeout.default", 20*time.Second)
+	v.SetDefault("tls.hsts_max_age", 365*24*time.Hour)
+	v.SetDefault("oauth.http_timeout", 10*time.Second)
+	v.SetDefault("oauth.google.enabled", true)
+	v.SetDefault("oauth.apple.enabled", true)
+	v.SetDefault("session.store", "redis")
+	v.SetDefault("session.idle_timeout", 30*time.Minute)
+	v.SetDefault("session.max_lifetime", 24*time.Hour)
+	v.SetDefault("session.touch_interval", time.Minute)
+	v.SetDefault("redis.addr", "localhost:6379")
+	v.SetDefault("redis.dial_timeout", 5*time.Second)
+	v.SetDefault("redis.read_timeout", 3*time.Second)
+	v.SetDefault("redis.write_timeout", 3*time.Second)
+	v.SetDefault("database.max_open_conns", 25)
+	v.SetDefault("database.max_idle_conns", 5)
+	v.SetDefault("database.conn_max_lifetime", 30*time.Minute)
+	v.SetDefault("search.timeout", 2*time.Second)
+	v.SetDefault("jwt.issuer", "gin-starter")
+	v.SetDefault("jwt.audience", "gin-starter-api")
+	v.SetDefault("jwt.access_ttl", 15*time.Minute)
+	v.SetDefault("jwt.refresh_ttl", 30*24*time.Hour)
+	v.SetDefault("jwt.refresh_max_lifetime", 90*24*time.Hour)
+	v.SetDefault("pat.max_lifetime", 365*24*time.Hour)
+	v.SetDefault("cookie.same_site", "lax")
+	v.SetDefault("cors.exposed_headers", []string{"X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"})
+	v.SetDefault("cors.max_age", 10*time.Minute)
+	// 默认策略适用于只返回 JSON 的 API
+	v.SetDefault("security_headers.content_security_policy", "default-src 'none'; frame-ancestors 'none'")
+	v.SetDefault("security_headers.frame_options", "DENY")
+	// OAuth 回调 URL 中带有授权码，不应通过 Referer 泄露
+	v.SetDefault("security_headers.referrer_policy", "no-referrer")
+	v.SetDefault("security_headers.permissions_policy", "camera=(), microphone=(), geolocation=()")
+	v.SetDefault("health.check_timeout", 2*time.Second)
+	v.SetDefault("metrics.enabled", true)
+	v.SetDefault("metrics.port", 9090)
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.service_name", "gin-starter")
+	v.SetDefault("tracing.sample_ratio", 1.0)
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "json")
+	v.SetDefault("rate_limit.enabled", true)
+	v.SetDefault("rate_limit.default", map[string]interface{}{"limit": 300, "window": "1m", "by": "user"})
+	v.SetDefault("rate_limit.failed_auth", map[string]interface{}{"limit": 10, "window": "1m", "by": "ip"})
+	v.SetDefault("rate_limit.routes", []map[string]interface{}{
+		{"path": "/auth/:provider/login", "limit": 10, "window": "1m", "by": "ip"},
+		{"path": "/auth/:provider/callback", "limit": 20, "window": "1m", "by": "ip"},
+		{"path": "/auth/token", "limit": 30, "window": "1m", "by": "ip"},
+	})
+}
+
+// LoadConfig reads configPath and, when profile is set, merges
+// config.<profile>.yaml from the same directory on top of it. Maps are merged
+// key by key while lists in the profile replace the base list. Environment
+// variables override both files.
+func LoadConfig(configPath, profile string) (*Config, error) {
+	// 每次加载使用独立的 viper 实例，热加载时不会与正在使用的配置互相影响
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	v.SetConfigType("yaml")
+
+	v.AutomaticEnv()
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	setDefaults(v)
+
+	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
+	if err := mergeProfile(v, configPath, profile); err != nil {
+		return nil, err
+	}
+	if err := bindEnv(v); err != nil {
+		return nil, err
+	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	// 从环境变量覆盖特定值
-	if envClientID := viper.GetString("GOOGLE_CLIENT_ID"); envClientID != "" {
-		config.OAuth.Google.ClientID = envClientID
-	}
-	if envClientSecret := viper.GetString("GOOGLE_CLIENT_SECRET"); envClientSecret != "" {
-		config.OAuth.Google.ClientSecret = envClientSecret
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
 	}
-	fmt.Println(config)
 
 	return &config, nil
 }
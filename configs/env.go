@@ -0,0 +1,130 @@
+// configs/env.go
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is the prefix of every environment variable overriding config.
+const EnvPrefix = "APP"
+
+// legacyEnvVars 是改名前的环境变量，为兼容旧部署仍然生效
+var legacyEnvVars = map[string]string{
+	"oauth.google.client_id":     "APP_GOOGLE_CLIENT_ID",
+	"oauth.google.client_secret": "APP_GOOGLE_CLIENT_SECRET",
+}
+
+// Field describes one overridable config setting.
+type Field struct {
+	// Key 是 YAML 中的路径，例如 "oauth.apple.team_id"
+	Key    string
+	EnvVar string
+	Type   string
+	Secret bool
+}
+
+// EnvVar returns the environment variable overriding key, e.g.
+// APP_OAUTH_APPLE_TEAM_ID for "oauth.apple.team_id". Setting
+// <EnvVar>_FILE instead reads the value from that file, which suits Docker
+// and Kubernetes secrets.
+func EnvVar(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Fields lists every setting that can be overridden from the environment,
+// sorted by key. Lists of structs such as session.encryption_keys and maps
+// such as cors.groups can only be set in the config file.
+func Fields() []Field {
+	var fields []Field
+	collectFields(reflect.TypeOf(Config{}), "", &fields)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+	return fields
+}
+
+var (
+	secretType   = reflect.TypeOf(Secret(""))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+func collectFields(t reflect.Type, prefix string, fields *[]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			collectFields(f.Type, prefix, fields)
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		var typ string
+		switch {
+		case f.Type == secretType:
+			typ = "secret"
+		case f.Type == durationType:
+			typ = "duration"
+		case f.Type.Kind() == reflect.Struct:
+			collectFields(f.Type, key+".", fields)
+			continue
+		case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.String:
+			typ = "list"
+		case f.Type.Kind() == reflect.Slice, f.Type.Kind() == reflect.Map:
+			continue
+		default:
+			typ = strings.TrimSuffix(f.Type.Kind().String(), "64")
+		}
+		*fields = append(*fields, Field{Key: key, EnvVar: EnvVar(key), Type: typ, Secret: typ == "secret"})
+	}
+}
+
+// bindEnv binds every field to its environment variable, so that
+// Unmarshal sees settings that only exist in the environment, and applies
+// _FILE variables.
+func bindEnv(v *viper.Viper) error {
+	for _, f := range Fields() {
+		names := []string{f.EnvVar}
+		if legacy, ok := legacyEnvVars[f.Key]; ok {
+			names = append(names, legacy)
+		}
+		if err := v.BindEnv(append([]string{f.Key}, names...)...); err != nil {
+			return err
+		}
+
+		path := os.Getenv(f.EnvVar + "_FILE")
+		if path == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(f.EnvVar); ok {
+			return fmt.Errorf("both %s and %s_FILE are set", f.EnvVar, f.EnvVar)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s_FILE: %w", f.EnvVar, err)
+		}
+		// 挂载的 secret 文件通常以换行结尾
+		v.Set(f.Key, strings.TrimRight(string(data), "\r\n"))
+	}
+	return nil
+}
+
+// Defaults returns the default value of every key that has one.
+func Defaults() map[string]interface{} {
+	v := viper.New()
+	setDefaults(v)
+	defaults := make(map[string]interface{})
+	for _, f := range Fields() {
+		if v.IsSet(f.Key) {
+			defaults[f.Key] = v.Get(f.Key)
+		}
+	}
+	return defaults
+}
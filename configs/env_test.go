@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("server:\n  port: 9000\noauth:\n  apple:\n    team_id: from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	secretPath := filepath.Join(dir, "csrf_secret")
+	if err := os.WriteFile(secretPath, []byte("0123456789abcdef0123456789abcdef\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("APP_OAUTH_APPLE_TEAM_ID", "from-env")
+	t.Setenv("APP_RATE_LIMIT_DEFAULT_LIMIT", "5")
+	t.Setenv("APP_SESSION_IDLE_TIMEOUT", "10m")
+	t.Setenv("APP_SESSION_STORE", "memory")
+	t.Setenv("APP_COOKIE_SECURE", "true")
+	t.Setenv("APP_CSRF_SECRET_FILE", secretPath)
+	// 旧的变量名仍然有效
+	t.Setenv("APP_GOOGLE_CLIENT_ID", "legacy-client")
+	t.Setenv("APP_OAUTH_GOOGLE_CLIENT_SECRET", "google-secret")
+	t.Setenv("APP_OAUTH_GOOGLE_REDIRECT_URL", "https://example.com/callback")
+
+	cfg, err := LoadConfig(configPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 {
+		t.Errorf("server.port = %d, want value from file", cfg.Server.Port)
+	}
+	if cfg.OAuth.Apple.TeamID != "from-env" {
+		t.Errorf("oauth.apple.team_id = %q, want value from env", cfg.OAuth.Apple.TeamID)
+	}
+	if cfg.RateLimit.Default.Limit != 5 || cfg.RateLimit.Default.Window != time.Minute {
+		t.Errorf("rate_limit.default = %+v", cfg.RateLimit.Default)
+	}
+	if cfg.Session.IdleTimeout != 10*time.Minute || !cfg.Cookie.Secure {
+		t.Errorf("session.idle_timeout = %s, cookie.secure = %v", cfg.Session.IdleTimeout, cfg.Cookie.Secure)
+	}
+	if cfg.CSRF.Secret.Value() != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("csrf.secret was not read from the _FILE variable")
+	}
+	if cfg.OAuth.Google.ClientID != "legacy-client" {
+		t.Errorf("oauth.google.client_id = %q, want legacy env value", cfg.OAuth.Google.ClientID)
+	}
+}
+
+func TestEnvFileConflict(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_REDIS_PASSWORD", "a")
+	t.Setenv("APP_REDIS_PASSWORD_FILE", configPath)
+
+	if _, err := LoadConfig(configPath, ""); err == nil {
+		t.Fatal("expected an error when both a variable and its _FILE variant are set")
+	}
+}
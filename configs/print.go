@@ -0,0 +1,73 @@
+// configs/print.go
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAML renders the effective config using the same keys as the config file.
+// With redact set, every Secret is replaced by [REDACTED].
+func (c *Config) YAML(redact bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(settings(reflect.ValueOf(*c), redact)); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// settings 按 mapstructure 标签把配置转换为 map，便于输出
+func settings(v reflect.Value, redact bool) interface{} {
+	switch {
+	case v.Type() == secretType:
+		if redact && v.String() != "" {
+			return redacted
+		}
+		return v.String()
+	case v.Type() == durationType:
+		return v.Interface().(time.Duration).String()
+	case v.Kind() == reflect.Struct:
+		m := make(map[string]interface{})
+		addFields(m, v, redact)
+		return m
+	case v.Kind() == reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = settings(iter.Value(), redact)
+		}
+		return m
+	case v.Kind() == reflect.Slice:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = settings(v.Index(i), redact)
+		}
+		return list
+	default:
+		return v.Interface()
+	}
+}
+
+func addFields(m map[string]interface{}, v reflect.Value, redact bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			addFields(m, v.Field(i), redact)
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		m[name] = settings(v.Field(i), redact)
+	}
+}
@@ -0,0 +1,38 @@
+// configs/profile.go
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ProfileEnvVar selects the config profile when no profile flag is given.
+const ProfileEnvVar = EnvPrefix + "_ENV"
+
+var profilePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ProfilePath returns the overlay file for profile, which sits next to the
+// base file: config.yaml with profile "prod" gives config.prod.yaml.
+func ProfilePath(configPath, profile string) string {
+	ext := filepath.Ext(configPath)
+	return strings.TrimSuffix(configPath, ext) + "." + profile + ext
+}
+
+// mergeProfile 把 profile 文件合并到已读取的基础配置之上
+func mergeProfile(v *viper.Viper, configPath, profile string) error {
+	if profile == "" {
+		return nil
+	}
+	if !profilePattern.MatchString(profile) {
+		return fmt.Errorf("invalid profile %q", profile)
+	}
+	v.SetConfigFile(ProfilePath(configPath, profile))
+	if err := v.MergeInConfig(); err != nil {
+		return fmt.Errorf("failed to read %s profile: %w", profile, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfileOverlay(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	base := "server:\n  port: 9000\nlog:\n  level: debug\n  format: text\n"
+	if err := os.WriteFile(configPath, []byte(base), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prod := "log:\n  level: warn\ncsrf:\n  secret: 0123456789abcdef0123456789abcdef\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.prod.yaml"), []byte(prod), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_SERVER_PORT", "9100")
+	t.Setenv("APP_SESSION_STORE", "memory")
+
+	cfg, err := LoadConfig(configPath, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// profile 只覆盖它设置的键，环境变量优先于两个文件
+	if cfg.Log.Level != "warn" || cfg.Log.Format != "text" {
+		t.Errorf("log = %+v, want level from profile and format from base", cfg.Log)
+	}
+	if cfg.Server.Port != 9100 {
+		t.Errorf("server.port = %d, want value from env", cfg.Server.Port)
+	}
+
+	out, err := cfg.YAML(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "0123456789abcdef") || !strings.Contains(string(out), "secret: '[REDACTED]'") {
+		t.Errorf("redacted output:\n%s", out)
+	}
+	if !strings.Contains(string(out), "port: 9100") {
+		t.Errorf("output is missing the effective port:\n%s", out)
+	}
+
+	if _, err := LoadConfig(configPath, "staging"); err == nil {
+		t.Error("expected an error for a profile without a config file")
+	}
+}
@@ -0,0 +1,40 @@
+// configs/secret.go
+package config
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is a config value that must not be printed. It formats, logs and
+// marshals as [REDACTED]; use Value to read the actual secret.
+type Secret string
+
+// Value returns the secret in plain text.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString 覆盖 %#v，否则会打印原始字符串
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// Format 覆盖 %s、%v、%q 等所有格式化动词
+func (s Secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, redacted)
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSecretIsNeverPrinted(t *testing.T) {
+	var cfg Config
+	cfg.OAuth.Google.ClientSecret = "google-secret"
+	cfg.CSRF.Secret = "csrf-secret"
+	cfg.Session.EncryptionKeys = []EncryptionKey{{ID: "k1", Key: "session-key"}}
+
+	var buf bytes.Buffer
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q"} {
+		fmt.Fprintf(&buf, verb+"\n", cfg)
+		fmt.Fprintf(&buf, verb+"\n", cfg.CSRF.Secret)
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(b)
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("config", "config", cfg, "secret", cfg.CSRF.Secret)
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("config", "config", cfg, "secret", cfg.CSRF.Secret)
+
+	out := buf.String()
+	for _, secret := range []string{"google-secret", "csrf-secret", "session-key"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("output leaks %q: %s", secret, out)
+		}
+	}
+	if cfg.CSRF.Secret.Value() != "csrf-secret" {
+		t.Fatalf("Value() = %q", cfg.CSRF.Secret.Value())
+	}
+}
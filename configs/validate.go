@@ -0,0 +1,256 @@
+// configs/validate.go
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// minSecretLength 是 HMAC 类密钥的最短长度（字节）
+const minSecretLength = 32
+
+// Validate checks the whole config and reports every problem at once, one
+// per line, so a broken deployment can be fixed in a single pass.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port: must be between 1 and 65535, got %d", c.Server.Port)
+	v.nonNegative("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	v.nonNegative("server.read_timeout", c.Server.ReadTimeout)
+	v.nonNegative("server.write_timeout", c.Server.WriteTimeout)
+	v.nonNegative("server.idle_timeout", c.Server.IdleTimeout)
+	v.nonNegative("server.shutdown_delay", c.Server.ShutdownDelay)
+	v.positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	for i, proxy := range c.Server.TrustedProxies {
+		v.check(validProxy(proxy), "server.trusted_proxies[%d]: %q is not an IP address or CIDR", i, proxy)
+	}
+	v.requestTimeout("request_timeout.default", c.RequestTimeout.Default, c.Server.WriteTimeout)
+	for prefix, budget := range c.RequestTimeout.Groups {
+		v.check(strings.HasPrefix(prefix, "/"), "request_timeout.groups: %q must be a path prefix starting with /", prefix)
+		// 组的预算可以为 0，表示不设预算
+		if budget != 0 {
+			v.requestTimeout("request_timeout.groups."+prefix, budget, c.Server.WriteTimeout)
+		}
+	}
+
+	if c.TLS.Enabled {
+		if c.TLS.SelfSigned {
+			v.check(c.TLS.CertFile == "" && c.TLS.KeyFile == "", "tls.self_signed: cannot be combined with tls.cert_file and tls.key_file")
+		} else {
+			v.check(c.TLS.CertFile != "", "tls.cert_file: required when tls is enabled")
+			v.check(c.TLS.KeyFile != "", "tls.key_file: required when tls is enabled")
+		}
+		v.check(c.TLS.RedirectPort >= 0 && c.TLS.RedirectPort <= 65535, "tls.redirect_port: must be between 0 and 65535, got %d", c.TLS.RedirectPort)
+		v.check(c.TLS.RedirectPort != c.Server.Port, "tls.redirect_port: must differ from server.port")
+		v.nonNegative("tls.hsts_max_age", c.TLS.HSTSMaxAge)
+	}
+
+	v.positive("oauth.http_timeout", c.OAuth.HTTPTimeout)
+	if c.OAuth.Google.Enabled && c.OAuth.Google.ClientID != "" {
+		v.check(c.OAuth.Google.ClientSecret != "", "oauth.google.client_secret: required when client_id is set")
+		v.url("oauth.google.redirect_url", c.OAuth.Google.RedirectURL)
+	}
+	if c.OAuth.Apple.Enabled && c.OAuth.Apple.ClientID != "" {
+		v.check(c.OAuth.Apple.TeamID != "", "oauth.apple.team_id: required when client_id is set")
+		v.check(c.OAuth.Apple.KeyID != "", "oauth.apple.key_id: required when client_id is set")
+		v.check(c.OAuth.Apple.KeyPath != "", "oauth.apple.key_path: required when client_id is set")
+		v.url("oauth.apple.redirect_url", c.OAuth.Apple.RedirectURL)
+	}
+
+	v.oneOf("session.store", c.Session.Store, "redis", "memory")
+	v.positive("session.idle_timeout", c.Session.IdleTimeout)
+	v.positive("session.max_lifetime", c.Session.MaxLifetime)
+	v.check(c.Session.MaxLifetime >= c.Session.IdleTimeout, "session.max_lifetime: must not be shorter than session.idle_timeout")
+	v.positive("session.touch_interval", c.Session.TouchInterval)
+	v.check(c.Session.TouchInterval < c.Session.IdleTimeout, "session.touch_interval: must be shorter than session.idle_timeout")
+	keyIDs := make([]string, len(c.Session.EncryptionKeys))
+	for i, k := range c.Session.EncryptionKeys {
+		keyIDs[i] = k.ID
+		// 密文格式为 <id>.<payload>，ID 中不能出现分隔符
+		v.check(!strings.Contains(k.ID, "."), "session.encryption_keys[%d].id: must not contain \".\"", i)
+		key, err := base64.StdEncoding.DecodeString(k.Key.Value())
+		switch {
+		case err != nil:
+			v.add("session.encryption_keys[%d].key: not valid base64", i)
+		case len(key) != 16 && len(key) != 24 && len(key) != 32:
+			v.add("session.encryption_keys[%d].key: must decode to 16, 24 or 32 bytes, got %d", i, len(key))
+		}
+	}
+	v.keyIDs("session.encryption_keys", keyIDs, c.Session.ActiveKeyID, "session.active_key_id")
+
+	if c.Session.Store == "redis" {
+		v.check(c.Redis.Addr != "", "redis.addr: required when session.store is redis")
+		// 随机密钥只在本进程内有效，共享存储中的数据其他实例无法解密
+		v.check(len(c.Session.EncryptionKeys) > 0, "session.encryption_keys: required when session.store is redis")
+	}
+	v.check(c.Redis.DB >= 0, "redis.db: must not be negative")
+	v.check(c.Redis.PoolSize >= 0, "redis.pool_size: must not be negative")
+	v.nonNegative("redis.dial_timeout", c.Redis.DialTimeout)
+	v.nonNegative("redis.read_timeout", c.Redis.ReadTimeout)
+	v.nonNegative("redis.write_timeout", c.Redis.WriteTimeout)
+
+	if c.Database.DSN != "" {
+		v.check(c.Database.Driver != "", "database.driver: required when database.dsn is set")
+	}
+	v.check(c.Database.MaxOpenConns >= 0, "database.max_open_conns: must not be negative")
+	v.check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns: must not be negative")
+	v.nonNegative("database.conn_max_lifetime", c.Database.ConnMaxLifetime)
+
+	if c.Search.URL != "" {
+		v.url("search.url", c.Search.URL)
+		v.positive("search.timeout", c.Search.Timeout)
+	}
+
+	v.oneOf("cookie.same_site", strings.ToLower(c.Cookie.SameSite), "lax", "strict", "none")
+	if strings.EqualFold(c.Cookie.SameSite, "none") {
+		v.check(c.Cookie.Secure || c.TLS.Enabled, "cookie.same_site: none requires cookie.secure or tls.enabled")
+	}
+	v.cors("cors", c.CORS.CORSPolicy)
+	for prefix, policy := range c.CORS.Groups {
+		v.check(strings.HasPrefix(prefix, "/"), "cors.groups: %q must be a path prefix starting with /", prefix)
+		v.cors("cors.groups."+prefix, policy)
+	}
+	for prefix := range c.SecurityHeaders.Groups {
+		v.check(strings.HasPrefix(prefix, "/"), "security_headers.groups: %q must be a path prefix starting with /", prefix)
+	}
+	v.secret("csrf.secret", c.CSRF.Secret)
+
+	v.check(c.JWT.Issuer != "", "jwt.issuer: required")
+	v.check(c.JWT.Audience != "", "jwt.audience: required")
+	v.positive("jwt.access_ttl", c.JWT.AccessTTL)
+	v.check(c.JWT.RefreshTTL > c.JWT.AccessTTL, "jwt.refresh_ttl: must be longer than jwt.access_ttl")
+	v.check(c.JWT.RefreshMaxLifetime >= c.JWT.RefreshTTL, "jwt.refresh_max_lifetime: must not be shorter than jwt.refresh_ttl")
+	keyIDs = make([]string, len(c.JWT.SigningKeys))
+	for i, k := range c.JWT.SigningKeys {
+		keyIDs[i] = k.ID
+		v.check(k.KeyPath != "", "jwt.signing_keys[%d].key_path: required", i)
+	}
+	v.keyIDs("jwt.signing_keys", keyIDs, c.JWT.ActiveKeyID, "jwt.active_key_id")
+
+	v.positive("pat.max_lifetime", c.PAT.MaxLifetime)
+
+	v.policy("rate_limit.default", c.RateLimit.Default)
+	for i, route := range c.RateLimit.Routes {
+		v.check(strings.HasPrefix(route.Path, "/"), "rate_limit.routes[%d].path: must be a route template starting with /", i)
+		v.policy(fmt.Sprintf("rate_limit.routes[%d]", i), route.RateLimitPolicy)
+	}
+	v.policy("rate_limit.failed_auth", c.RateLimit.FailedAuth)
+	// 无效凭证没有对应的用户，只能按 IP 计数
+	v.check(c.RateLimit.FailedAuth.By == "ip", "rate_limit.failed_auth.by: must be ip")
+
+	v.positive("health.check_timeout", c.Health.CheckTimeout)
+	if c.Metrics.Enabled {
+		v.check(c.Metrics.Port > 0 && c.Metrics.Port <= 65535, "metrics.port: must be between 1 and 65535, got %d", c.Metrics.Port)
+		v.check(c.Metrics.Port != c.Server.Port, "metrics.port: must differ from server.port")
+		v.check(!c.TLS.Enabled || c.Metrics.Port != c.TLS.RedirectPort, "metrics.port: must differ from tls.redirect_port")
+	}
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout", "otlp")
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio: must be between 0 and 1")
+
+	var level slog.Level
+	v.check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level: must be one of debug, info, warn, error, got %q", c.Log.Level)
+	v.oneOf("log.format", c.Log.Format, "json", "text")
+
+	return errors.Join(v.errs...)
+}
+
+// validator 收集所有校验错误，而不是遇到第一个就返回
+type validator struct {
+	errs []error
+}
+
+func validProxy(value string) bool {
+	if strings.Contains(value, "/") {
+		_, _, err := net.ParseCIDR(value)
+		return err == nil
+	}
+	return net.ParseIP(value) != nil
+}
+
+func (v *validator) add(format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validator) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		v.add(format, args...)
+	}
+}
+
+func (v *validator) positive(key string, d time.Duration) {
+	v.check(d > 0, "%s: must be positive", key)
+}
+
+func (v *validator) nonNegative(key string, d time.Duration) {
+	v.check(d >= 0, "%s: must not be negative", key)
+}
+
+// requestTimeout 要求预算短于 server.write_timeout，否则连接会先于 504 被关闭
+func (v *validator) requestTimeout(key string, budget, writeTimeout time.Duration) {
+	if writeTimeout > 0 {
+		v.check(budget > 0 && budget < writeTimeout, "%s: must be set and shorter than server.write_timeout (%s), got %s", key, writeTimeout, budget)
+		return
+	}
+	v.nonNegative(key, budget)
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add("%s: must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) url(key, value string) {
+	u, err := url.Parse(value)
+	v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "%s: must be an absolute http(s) URL", key)
+}
+
+// secret 允许为空（使用随机值），但配置了就必须足够长
+func (v *validator) secret(key string, value Secret) {
+	v.check(value == "" || len(value) >= minSecretLength, "%s: must be at least %d bytes", key, minSecretLength)
+}
+
+// keyIDs 检查密钥 ID 唯一，且多个密钥时必须指定存在的当前密钥
+func (v *validator) keyIDs(key string, ids []string, activeID, activeKey string) {
+	seen := make(map[string]bool, len(ids))
+	for i, id := range ids {
+		v.check(id != "", "%s[%d].id: required", key, i)
+		v.check(id == "" || !seen[id], "%s[%d].id: duplicate id %q", key, i, id)
+		seen[id] = true
+	}
+	switch {
+	case activeID != "":
+		v.check(seen[activeID], "%s: no key with id %q", activeKey, activeID)
+	case len(ids) > 1:
+		v.add("%s: required when more than one key is configured", activeKey)
+	}
+}
+
+func (v *validator) cors(key string, p CORSPolicy) {
+	for i, origin := range p.AllowedOrigins {
+		if origin == "*" {
+			v.check(!p.AllowCredentials, "%s.allowed_origins: \"*\" cannot be combined with allow_credentials", key)
+			continue
+		}
+		u, err := url.Parse(origin)
+		v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == "",
+			"%s.allowed_origins[%d]: must be \"*\" or an origin like https://app.example.com, got %q", key, i, origin)
+	}
+	v.nonNegative(key+".max_age", p.MaxAge)
+}
+
+func (v *validator) policy(key string, p RateLimitPolicy) {
+	v.check(p.Limit > 0, "%s.limit: must be positive", key)
+	v.positive(key+".window", p.Window)
+	v.oneOf(key+".by", p.By, "ip", "user")
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultConfig 返回只包含默认值的配置
+func defaultConfig(t *testing.T) *Config {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setDefaults(viper.GetViper())
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	cfg := defaultConfig(t)
+	// 默认的 redis 存储没有可用的默认密钥，必须由部署方提供
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "session.encryption_keys: required when session.store is redis") {
+		t.Errorf("redis store without encryption keys: err = %v", err)
+	}
+	cfg.Session.EncryptionKeys = []EncryptionKey{{ID: "k1", Key: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default config is invalid:\n%v", err)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	cfg := defaultConfig(t)
+	cfg.Server.Port = 0
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.internal"}
+	cfg.Session.Store = "memcached"
+	cfg.Session.IdleTimeout = 48 * time.Hour
+	cfg.Session.EncryptionKeys = []EncryptionKey{{ID: "k1", Key: "not base64!"}, {ID: "k1", Key: "c2hvcnQ="}, {ID: "k.2", Key: "MDEyMzQ1Njc4OWFiY2RlZg=="}}
+	cfg.Cookie.SameSite = "none"
+	cfg.CSRF.Secret = "short"
+	cfg.OAuth.Google.ClientID = "client"
+	cfg.Search.URL = "elastic:9200"
+	cfg.RateLimit.Routes[0].By = "session"
+	cfg.Log.Level = "verbose"
+	cfg.JWT.RefreshMaxLifetime = 7 * 24 * time.Hour
+	cfg.RequestTimeout.Groups = map[string]time.Duration{"/auth": time.Minute, "/export": 0}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"server.port",
+		`server.trusted_proxies[1]: "proxy.internal" is not an IP address`,
+		"session.store",
+		"session.max_lifetime",
+		"session.encryption_keys[0].key: not valid base64",
+		"session.encryption_keys[1].key: must decode to 16, 24 or 32 bytes",
+		`session.encryption_keys[1].id: duplicate id "k1"`,
+		`session.encryption_keys[2].id: must not contain "."`,
+		"session.active_key_id",
+		"cookie.same_site: none requires cookie.secure",
+		"csrf.secret",
+		"oauth.google.client_secret",
+		"oauth.google.redirect_url",
+		"search.url",
+		"rate_limit.routes[0].by",
+		"log.level",
+		"jwt.refresh_max_lifetime",
+		"request_timeout.groups./auth: must be set and shorter than server.write_timeout",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "request_timeout.groups./export") {
+		t.Error("a group budget of 0 was rejected")
+	}
+	if strings.Contains(err.Error(), "not base64!") {
+		t.Error("error leaks the secret value")
+	}
+}
@@ -0,0 +1,120 @@
+// configs/watch.go
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// reloadDelay is how long Watch waits after the last file event before
+// reloading.
+const reloadDelay = 100 * time.Millisecond
+
+// Change is one setting that differs between two configs. Secrets are shown
+// as [REDACTED] even when their value changed.
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+// Diff lists the settings that differ between old and new, sorted by key.
+func Diff(old, new *Config) []Change {
+	before, after := flatten(old, false), flatten(new, false)
+	beforeRedacted, afterRedacted := flatten(old, true), flatten(new, true)
+
+	var changes []Change
+	for key, value := range after {
+		if before[key] != value {
+			changes = append(changes, Change{Key: key, Old: beforeRedacted[key], New: afterRedacted[key]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// flatten 把配置展开为 "a.b.c" 形式的键；列表整体作为一个值比较
+func flatten(c *Config, redact bool) map[string]string {
+	flat := make(map[string]string)
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				walk(prefix+k+".", child)
+			}
+		case []interface{}:
+			data, _ := json.Marshal(v)
+			flat[prefix[:len(prefix)-1]] = string(data)
+		default:
+			flat[prefix[:len(prefix)-1]] = fmt.Sprint(v)
+		}
+	}
+	walk("", settings(reflect.ValueOf(*c), redact))
+	return flat
+}
+
+// Watch reloads the config whenever the base or profile file changes. A
+// version that fails to load or validate is logged and ignored, so the
+// service keeps running with the last good config. Otherwise the changed
+// settings are logged and passed to onChange together with both configs.
+// If onChange returns an error the new version is rejected the same way and
+// later changes are compared with the config still in use. onChange is
+// never called concurrently.
+func Watch(current *Config, configPath, profile string, onChange func(old, new *Config, changes []Change) error) {
+	var mu sync.Mutex
+	reload := func(file string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		next, err := LoadConfig(configPath, profile)
+		if err != nil {
+			slog.Error("config reload failed, keeping the current config", "file", file, "error", err)
+			return
+		}
+		// 编辑器保存时可能触发多次事件，内容未变时不做处理
+		changes := Diff(current, next)
+		if len(changes) == 0 {
+			return
+		}
+		for _, change := range changes {
+			slog.Info("config changed", "setting", change.Key, "old", change.Old, "new", change.New)
+		}
+		if err := onChange(current, next, changes); err != nil {
+			slog.Error("config reload rejected, keeping the current config", "file", file, "error", err)
+			return
+		}
+		current = next
+	}
+
+	// 写文件会先截断再写入，等事件停止一段时间后再读取，避免读到写了一半的文件
+	var timerMu sync.Mutex
+	var timer *time.Timer
+	schedule := func(e fsnotify.Event) {
+		timerMu.Lock()
+		defer timerMu.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(reloadDelay, func() { reload(e.Name) })
+	}
+
+	files := []string{configPath}
+	if profile != "" {
+		files = append(files, ProfilePath(configPath, profile))
+	}
+	for _, file := range files {
+		w := viper.New()
+		w.SetConfigFile(file)
+		w.OnConfigChange(schedule)
+		w.WatchConfig()
+	}
+}
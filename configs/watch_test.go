@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchReload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("rate_limit:\n  default:\n    limit: 10\n    window: 1m\n    by: ip\ncsrf:\n  secret: 0123456789abcdef0123456789abcdef\nsession:\n  store: memory\n")
+
+	cfg, err := LoadConfig(configPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan []Change, 10)
+	Watch(cfg, configPath, "", func(old, new *Config, changes []Change) error {
+		// 模拟应用拒绝 limit 为 15 的配置
+		if new.RateLimit.Default.Limit == 15 {
+			return errors.New("rejected")
+		}
+		reloaded <- changes
+		return nil
+	})
+
+	// 校验失败的版本被忽略
+	write("rate_limit:\n  default:\n    limit: -1\n")
+	select {
+	case changes := <-reloaded:
+		t.Fatalf("invalid config was applied: %+v", changes)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// 被拒绝的版本也被忽略，之后的变化仍与当前配置比较
+	write("rate_limit:\n  default:\n    limit: 15\n    window: 1m\n    by: ip\ncsrf:\n  secret: 0123456789abcdef0123456789abcdef\nsession:\n  store: memory\n")
+	select {
+	case changes := <-reloaded:
+		t.Fatalf("rejected config was applied: %+v", changes)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	write("rate_limit:\n  default:\n    limit: 20\n    window: 1m\n    by: ip\ncsrf:\n  secret: abcdefghijklmnopqrstuvwxyz0123456789\nsession:\n  store: memory\n")
+	select {
+	case changes := <-reloaded:
+		want := []Change{
+			{Key: "csrf.secret", Old: redacted, New: redacted},
+			{Key: "rate_limit.default.limit", Old: "10", New: "20"},
+		}
+		if len(changes) != len(want) {
+			t.Fatalf("changes = %+v, want %+v", changes, want)
+		}
+		for i := range want {
+			if changes[i] != want[i] {
+				t.Errorf("changes[%d] = %+v, want %+v", i, changes[i], want[i])
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+}
@@ -0,0 +1,353 @@
+// internal/app/app.go
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/majiayu000/gin-starter/configs"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/auth/oauth"
+	"github.com/majiayu000/gin-starter/internal/handlers"
+	"github.com/majiayu000/gin-starter/internal/health"
+	"github.com/majiayu000/gin-starter/internal/metrics"
+	"github.com/majiayu000/gin-starter/internal/middleware"
+	"github.com/majiayu000/gin-starter/internal/repositories"
+	"github.com/majiayu000/gin-starter/internal/router"
+	"github.com/majiayu000/gin-starter/internal/services"
+	"github.com/majiayu000/gin-starter/internal/tracing"
+	"github.com/majiayu000/gin-starter/internal/types"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// App is the application container. It builds every long-lived dependency
+// from config once, in dependency order, and hands them to the router.
+type App struct {
+	Config *config.Config
+
+	SessionManager types.SessionManager
+	OAuthManager   *auth.OAuthManager
+	TokenService   *auth.TokenService
+	PATService     *auth.PATService
+	UserService    *services.UserService
+	RateLimiter    middleware.RateLimiter
+	RateLimitRules *middleware.RateLimitRules
+	CSRFKey        []byte
+	Readiness      *health.Readiness
+
+	// ErrorReporter, if set before Router is called, receives panics
+	// recovered while serving requests.
+	ErrorReporter middleware.ErrorReporter
+
+	// stopSync 停止后台的 provider 同步和会话计数
+	stopSync context.CancelFunc
+}
+
+// providerSyncInterval 是从共享存储刷新停用 provider 的间隔
+const providerSyncInterval = 10 * time.Second
+
+// sessionCountInterval 是刷新 active_sessions 指标的间隔，计数需要扫描会话存储
+const sessionCountInterval = 30 * time.Second
+
+// New builds the application from cfg. Call Close when done.
+func New(cfg *config.Config) (*App, error) {
+	a := &App{Config: cfg}
+
+	keyring, err := newSessionKeyring(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session encryption keys: %w", err)
+	}
+	sameSite, err := auth.ParseSameSite(cfg.Cookie.SameSite)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cookie config: %w", err)
+	}
+	sessionOptions := auth.SessionOptions{
+		IdleTimeout:   cfg.Session.IdleTimeout,
+		MaxLifetime:   cfg.Session.MaxLifetime,
+		TouchInterval: cfg.Session.TouchInterval,
+		Keyring:       keyring,
+		Cookie: auth.CookieOptions{
+			Domain:   cfg.Cookie.Domain,
+			Secure:   cookieSecure(cfg),
+			SameSite: sameSite,
+		},
+	}
+	switch cfg.Session.Store {
+	case "memory":
+		slog.Warn("using in-memory session store; sessions are not shared between instances")
+		a.SessionManager = auth.NewMemorySessionManager(sessionOptions)
+	case "redis":
+		sm := auth.NewSessionManager(&goredis.Options{
+			Addr:         cfg.Redis.Addr,
+			Password:     cfg.Redis.Password.Value(),
+			DB:           cfg.Redis.DB,
+			PoolSize:     cfg.Redis.PoolSize,
+			DialTimeout:  cfg.Redis.DialTimeout,
+			ReadTimeout:  cfg.Redis.ReadTimeout,
+			WriteTimeout: cfg.Redis.WriteTimeout,
+			// 命令遵守请求 context 的截止时间，而不只是 read/write timeout
+			ContextTimeoutEnabled: true,
+		}, sessionOptions)
+		sm.RedisClient().AddHook(tracing.RedisHook())
+		if cfg.Metrics.Enabled {
+			sm.RedisClient().AddHook(metrics.RedisHook())
+		}
+		a.SessionManager = sm
+	default:
+		return nil, fmt.Errorf("unknown session store %q", cfg.Session.Store)
+	}
+
+	if a.CSRFKey, err = secretOrRandom("csrf.secret", cfg.CSRF.Secret); err != nil {
+		a.Close()
+		return nil, err
+	}
+
+	// 停用的 provider 保存在会话存储中，所有实例共享
+	a.OAuthManager = auth.NewSharedOAuthManager(a.SessionManager)
+	providers, err := newOAuthProviders(cfg, a.SessionManager)
+	if err != nil {
+		return nil, err
+	}
+	a.OAuthManager.ReplaceProviders(providers)
+	syncCtx, cancel := context.WithTimeout(context.Background(), providerSyncInterval)
+	if err := a.OAuthManager.Sync(syncCtx); err != nil {
+		slog.Error("failed to load disabled OAuth providers", "error", err)
+	}
+	cancel()
+	syncCtx, a.stopSync = context.WithCancel(context.Background())
+	go a.OAuthManager.SyncEvery(syncCtx, providerSyncInterval)
+	if a.TokenService, err = newTokenService(cfg, a.SessionManager); err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to initialize token service: %w", err)
+	}
+	a.PATService = auth.NewPATService(a.SessionManager, auth.PATOptions{MaxLifetime: cfg.PAT.MaxLifetime})
+	a.UserService = services.NewUserService(repositories.NewUserRepository())
+	a.RateLimiter = newRateLimiter(a.SessionManager)
+	a.RateLimitRules = middleware.NewRateLimitRules(rateLimitPolicies(cfg))
+	a.RateLimitRules.UpdateFailedAuth(failedAuthPolicy(cfg))
+
+	a.Readiness = health.NewReadiness(cfg.Health.CheckTimeout)
+	// 数据库和搜索索引接入后在此注册对应的检查
+	a.Readiness.AddCheck(cfg.Session.Store, a.SessionManager.Ping)
+	if cfg.Metrics.Enabled {
+		metrics.RegisterActiveSessions(syncCtx, a.SessionManager.CountSessions, sessionCountInterval)
+	}
+	return a, nil
+}
+
+// Router builds the HTTP handler with every route group mounted.
+func (a *App) Router() *gin.Engine {
+	return router.SetupRouter(router.Dependencies{
+		Config:         a.Config,
+		SessionManager: a.SessionManager,
+		TokenService:   a.TokenService,
+		PATService:     a.PATService,
+		RateLimiter:    a.RateLimiter,
+		RateLimitRules: a.RateLimitRules,
+		CSRFKey:        a.CSRFKey,
+		Readiness:      a.Readiness,
+		ErrorReporter:  a.ErrorReporter,
+
+		AuthHandler:  handlers.NewAuthHandler(a.OAuthManager, a.SessionManager, a.TokenService),
+		TokenHandler: handlers.NewTokenHandler(a.TokenService),
+		PATHandler:   handlers.NewPATHandler(a.PATService),
+		AdminHandler: handlers.NewAdminHandler(a.OAuthManager),
+		UserHandler:  handlers.NewUserHandler(a.UserService),
+	})
+}
+
+// MetricsRouter returns the handler for the metrics port.
+func (a *App) MetricsRouter() *gin.Engine {
+	return router.SetupMetricsRouter()
+}
+
+// Reload applies the settings that can change without a restart: OAuth
+// providers and rate limits. It is meant for config.Watch. If an enabled
+// provider can't be built from next, nothing is applied and the error is
+// returned, so a typo can't silently turn off a login method.
+func (a *App) Reload(_, next *config.Config, changes []config.Change) error {
+	providers, err := newOAuthProviders(next, a.SessionManager)
+	if err != nil {
+		return err
+	}
+	a.OAuthManager.ReplaceProviders(providers)
+	a.RateLimitRules.Update(rateLimitPolicies(next))
+	a.RateLimitRules.UpdateFailedAuth(failedAuthPolicy(next))
+	for _, change := range changes {
+		if !reloadable(change.Key) {
+			slog.Warn("config change takes effect after a restart", "setting", change.Key)
+		}
+	}
+	return nil
+}
+
+// Close releases the connections held by the application. Call it after
+// the server has stopped serving requests.
+func (a *App) Close() {
+	if a.stopSync != nil {
+		a.stopSync()
+	}
+	if a.SessionManager != nil {
+		if err := a.SessionManager.Close(); err != nil {
+			slog.Error("failed to close session store", "error", err)
+		}
+	}
+}
+
+// newSessionKeyring builds the session encryption keyring from config. When
+// no keys are configured, which Validate only allows for the memory store, a
+// random key is used and sessions don't survive a restart.
+func newSessionKeyring(cfg *config.Config) (*auth.Keyring, error) {
+	if len(cfg.Session.EncryptionKeys) == 0 {
+		slog.Warn("no session encryption keys configured, using a random key")
+		return auth.NewRandomKeyring(), nil
+	}
+
+	keys := make(map[string][]byte, len(cfg.Session.EncryptionKeys))
+	for _, k := range cfg.Session.EncryptionKeys {
+		key, err := base64.StdEncoding.DecodeString(k.Key.Value())
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.ID, err)
+		}
+		keys[k.ID] = key
+	}
+	activeID := cfg.Session.ActiveKeyID
+	if activeID == "" && len(cfg.Session.EncryptionKeys) == 1 {
+		activeID = cfg.Session.EncryptionKeys[0].ID
+	}
+	return auth.NewKeyring(activeID, keys)
+}
+
+// newTokenService builds the JWT token service from config. When no signing
+// keys are configured a random key is used and issued tokens don't survive a
+// restart.
+func newTokenService(cfg *config.Config, sm types.SessionManager) (*auth.TokenService, error) {
+	options := auth.TokenOptions{
+		Issuer:             cfg.JWT.Issuer,
+		Audience:           cfg.JWT.Audience,
+		AccessTTL:          cfg.JWT.AccessTTL,
+		RefreshTTL:         cfg.JWT.RefreshTTL,
+		RefreshMaxLifetime: cfg.JWT.RefreshMaxLifetime,
+		SigningKeys:        make(map[string]*ecdsa.PrivateKey),
+		ActiveKeyID:        cfg.JWT.ActiveKeyID,
+	}
+
+	if len(cfg.JWT.SigningKeys) == 0 {
+		slog.Warn("no JWT signing keys configured, using a random key")
+		key, err := auth.GenerateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		options.SigningKeys["ephemeral"] = key
+		options.ActiveKeyID = "ephemeral"
+		return auth.NewTokenService(sm, options)
+	}
+
+	for _, k := range cfg.JWT.SigningKeys {
+		key, err := auth.LoadSigningKey(k.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", k.ID, err)
+		}
+		options.SigningKeys[k.ID] = key
+	}
+	if options.ActiveKeyID == "" && len(cfg.JWT.SigningKeys) == 1 {
+		options.ActiveKeyID = cfg.JWT.SigningKeys[0].ID
+	}
+	return auth.NewTokenService(sm, options)
+}
+
+// cookieSecure 在服务直接提供 HTTPS 时总是设置 Secure
+func cookieSecure(cfg *config.Config) bool {
+	return cfg.Cookie.Secure || cfg.TLS.Enabled
+}
+
+// secretOrRandom returns the configured secret, or a random key with a
+// warning when it is empty. Without a configured CSRF secret clients must
+// fetch a new token after a restart.
+func secretOrRandom(name string, secret config.Secret) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret.Value()), nil
+	}
+	slog.Warn("secret not configured, using a random key", "setting", name)
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate %s: %w", name, err)
+	}
+	return key, nil
+}
+
+// newRateLimiter 在使用 Redis 会话存储时共享 Redis 计数，否则在进程内计数
+func newRateLimiter(sm types.SessionManager) middleware.RateLimiter {
+	if rs, ok := sm.(*auth.SessionManager); ok && rs.RedisClient() != nil {
+		return middleware.NewRedisRateLimiter(rs.RedisClient())
+	}
+	return middleware.NewMemoryRateLimiter()
+}
+
+// rateLimitPolicies returns the default and per-route policies from config.
+// When rate limiting is disabled both are empty, so nothing is limited.
+func rateLimitPolicies(cfg *config.Config) (middleware.RateLimitPolicy, map[string]middleware.RateLimitPolicy) {
+	if !cfg.RateLimit.Enabled {
+		return middleware.RateLimitPolicy{}, nil
+	}
+	routes := make(map[string]middleware.RateLimitPolicy, len(cfg.RateLimit.Routes))
+	for _, route := range cfg.RateLimit.Routes {
+		routes[route.Path] = middleware.RateLimitPolicy(route.RateLimitPolicy)
+	}
+	return middleware.RateLimitPolicy(cfg.RateLimit.Default), routes
+}
+
+// failedAuthPolicy returns the limit on invalid bearer tokens per IP, or a
+// zero policy when rate limiting is disabled.
+func failedAuthPolicy(cfg *config.Config) middleware.RateLimitPolicy {
+	if !cfg.RateLimit.Enabled {
+		return middleware.RateLimitPolicy{}
+	}
+	return middleware.RateLimitPolicy(cfg.RateLimit.FailedAuth)
+}
+
+// newOAuthProviders creates the enabled and configured OAuth providers,
+// Google first and then Apple; this fixed order is the order they are listed
+// in. It fails if any of them can't be initialized.
+func newOAuthProviders(cfg *config.Config, sm types.SessionManager) ([]auth.NamedProvider, error) {
+	var providers []auth.NamedProvider
+	if google := cfg.OAuth.Google; google.Enabled && google.ClientID != "" {
+		p, err := oauth.NewGoogleProvider(map[string]string{
+			"client_id":     google.ClientID,
+			"client_secret": google.ClientSecret.Value(),
+			"redirect_url":  google.RedirectURL,
+			"http_timeout":  cfg.OAuth.HTTPTimeout.String(),
+		}, sm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Google provider: %w", err)
+		}
+		providers = append(providers, auth.NamedProvider{Name: "google", Provider: p})
+	}
+	if apple := cfg.OAuth.Apple; apple.Enabled && apple.ClientID != "" {
+		p, err := oauth.NewAppleProvider(map[string]string{
+			"client_id":    apple.ClientID,
+			"team_id":      apple.TeamID,
+			"key_id":       apple.KeyID,
+			"private_key":  apple.KeyPath,
+			"redirect_url": apple.RedirectURL,
+			"http_timeout": cfg.OAuth.HTTPTimeout.String(),
+		}, sm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Apple provider: %w", err)
+		}
+		providers = append(providers, auth.NamedProvider{Name: "apple", Provider: p})
+	}
+	return providers, nil
+}
+
+// reloadable reports whether a changed setting is applied without a restart.
+func reloadable(key string) bool {
+	return strings.HasPrefix(key, "oauth.") || strings.HasPrefix(key, "rate_limit.")
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/majiayu000/gin-starter/configs"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"golang.org/x/oauth2"
+)
+
+const testConfig = `
+session:
+  store: memory
+admin:
+  emails: [admin@example.com]
+cors:
+  allowed_origins: [https://app.example.com]
+`
+
+// newTestApp builds an App from testConfig followed by extra.
+func newTestApp(t *testing.T, extra string) *App {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(testConfig+extra), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(configPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.Close)
+	return a
+}
+
+func TestRouterMountsAllGroups(t *testing.T) {
+	a := newTestApp(t, "")
+	r := a.Router()
+	ctx := context.Background()
+
+	login := func(email string) *http.Cookie {
+		t.Helper()
+		id, err := a.SessionManager.CreateSession(ctx, &oauth2.Token{AccessToken: "a"}, map[string]interface{}{"id": "1", "email": email, "email_verified": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Cookie{Name: auth.SessionCookieName, Value: id}
+	}
+	serve := func(method, path string, cookie *http.Cookie, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(http.MethodGet, "/healthz", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("/healthz status = %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/readyz", nil, nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before ready status = %d", w.Code)
+	}
+	a.Readiness.SetReady(true)
+	if w := serve(http.MethodGet, "/readyz", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("/readyz status = %d: %s", w.Code, w.Body)
+	}
+
+	// 指标只在单独的端口上提供
+	if w := serve(http.MethodGet, "/metrics", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("/metrics on the public router status = %d", w.Code)
+	}
+	w := httptest.NewRecorder()
+	a.MetricsRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "active_sessions") {
+		t.Errorf("metrics router = %d", w.Code)
+	}
+
+	// 未配置 provider 时登录返回 400
+	if w := serve(http.MethodGet, "/auth/google/login", nil, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("/auth/google/login status = %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/.well-known/jwks.json", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("/.well-known/jwks.json status = %d", w.Code)
+	}
+
+	if w := serve(http.MethodGet, "/api/user/7", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("/api/user/7 without session status = %d", w.Code)
+	}
+	user := login("jane@example.com")
+	w = serve(http.MethodGet, "/api/user/7", user, nil)
+	var body struct {
+		ID string `json:"id"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil || body.ID != "7" {
+		t.Errorf("/api/user/7 = %d %s", w.Code, w.Body)
+	}
+	if w := serve(http.MethodGet, "/api/me/tokens", user, nil); w.Code != http.StatusOK {
+		t.Errorf("/api/me/tokens status = %d", w.Code)
+	}
+
+	if w := serve(http.MethodGet, "/admin/providers", user, nil); w.Code != http.StatusForbidden {
+		t.Errorf("/admin/providers as user status = %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/admin/providers", login("admin@example.com"), nil); w.Code != http.StatusOK {
+		t.Errorf("/admin/providers as admin status = %d", w.Code)
+	}
+
+	w = serve(http.MethodOptions, "/api/user/7", nil, http.Header{
+		"Origin":                        {"https://app.example.com"},
+		"Access-Control-Request-Method": {http.MethodGet},
+	})
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("preflight = %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("security headers missing: %v", w.Header())
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	limits := `
+rate_limit:
+  routes:
+    - {path: "/auth/:provider/login", limit: 2, window: 1m, by: ip}
+`
+	loginStatuses := func(r *gin.Engine) []int {
+		var statuses []int
+		for i := 0; i < 4; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/auth/google/login", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			statuses = append(statuses, w.Code)
+		}
+		return statuses
+	}
+
+	// 默认不信任代理：伪造的 X-Forwarded-For 不影响限流
+	got := loginStatuses(newTestApp(t, limits).Router())
+	want := []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("untrusted proxy: statuses = %v, want %v", got, want)
+	}
+
+	// 来自可信代理的请求按 X-Forwarded-For 中的客户端计数
+	got = loginStatuses(newTestApp(t, limits+"server:\n  trusted_proxies: [192.0.2.0/24]\n").Router())
+	for _, status := range got {
+		if status == http.StatusTooManyRequests {
+			t.Errorf("trusted proxy: statuses = %v, want no 429", got)
+			break
+		}
+	}
+}
+
+func TestAPIRequiresTokenScope(t *testing.T) {
+	a := newTestApp(t, "")
+	r := a.Router()
+	user := map[string]interface{}{"id": "1", "email": "jane@example.com"}
+
+	tests := []struct {
+		scope  string
+		status int
+	}{
+		{auth.ScopeSearchRead, http.StatusForbidden},
+		{auth.ScopeProfileRead, http.StatusOK},
+	}
+	for _, tt := range tests {
+		_, token, err := a.PATService.Create(context.Background(), user, tt.scope, []string{tt.scope}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/user/7", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("token with %s: /api/user/7 status = %d, want %d", tt.scope, w.Code, tt.status)
+		}
+	}
+}
+
+func TestReloadKeepsProvidersWhenOneFails(t *testing.T) {
+	a := newTestApp(t, `
+oauth:
+  google:
+    client_id: google-client
+    client_secret: google-secret
+    redirect_url: https://example.com/auth/google/callback
+`)
+	want := a.OAuthManager.ListProviders()
+	if !reflect.DeepEqual(want, []string{"google"}) {
+		t.Fatalf("providers = %v", want)
+	}
+
+	// Apple 私钥文件不存在：整个重新加载被拒绝，Google 和限流都保持原样
+	next := *a.Config
+	next.OAuth.Apple.Enabled = true
+	next.OAuth.Apple.ClientID = "apple-client"
+	next.OAuth.Apple.KeyPath = filepath.Join(t.TempDir(), "missing.p8")
+	next.OAuth.Google.Enabled = false
+	if err := a.Reload(a.Config, &next, nil); err == nil {
+		t.Fatal("reload with a broken provider succeeded")
+	}
+	if got := a.OAuthManager.ListProviders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("providers after rejected reload = %v, want %v", got, want)
+	}
+}
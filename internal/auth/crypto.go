@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTamperedValue is returned when a stored value fails decryption or its
+// integrity check.
+var ErrTamperedValue = errors.New("stored value failed integrity check")
+
+// ErrUnknownKey is returned when a stored value was sealed with a key that is
+// not in the ring, e.g. by an instance that already has a newer key during a
+// rolling rotation. The value may be valid, so it should not be deleted.
+var ErrUnknownKey = errors.New("stored value sealed with an unknown key")
+
+const sealedPrefix = "v1."
+
+// Keyring encrypts and authenticates stored values with AES-GCM.
+//
+// Values are sealed with the active key and tagged with its ID, and can be
+// opened with any key in the ring. To rotate, add a new key, make it active,
+// and drop the old one once entries sealed with it have expired.
+type Keyring struct {
+	activeID string
+	aeads    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a Keyring from AES keys (16, 24 or 32 bytes) indexed by
+// key ID. activeID selects the key used for sealing.
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q not found", activeID)
+	}
+
+	k := &Keyring{activeID: activeID, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ".") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// NewRandomKeyring creates a Keyring with a single random key. Values sealed
+// with it can't be read after a restart or by other instances.
+func NewRandomKeyring() *Keyring {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	k, err := NewKeyring("ephemeral", map[string][]byte{"ephemeral": key})
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// Seal encrypts plaintext with the active key. additionalData is
+// authenticated but not stored; the same value must be passed to Open.
+func (k *Keyring) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	aead := k.aeads[k.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+
+	var buf bytes.Buffer
+	buf.WriteString(sealedPrefix)
+	buf.WriteString(k.activeID)
+	buf.WriteByte('.')
+	buf.WriteString(base64.RawURLEncoding.EncodeToString(sealed))
+	return buf.Bytes(), nil
+}
+
+// Open decrypts a value produced by Seal and verifies its integrity.
+func (k *Keyring) Open(value, additionalData []byte) ([]byte, error) {
+	rest, ok := strings.CutPrefix(string(value), sealedPrefix)
+	if !ok {
+		return nil, ErrTamperedValue
+	}
+	keyID, payload, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, ErrTamperedValue
+	}
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrTamperedValue
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrTamperedValue
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	k, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := k.Seal([]byte(`{"access_token":"secret"}`), []byte("session:a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("sealed value contains plaintext: %s", sealed)
+	}
+
+	plaintext, err := k.Open(sealed, []byte("session:a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != `{"access_token":"secret"}` {
+		t.Fatalf("plaintext = %s", plaintext)
+	}
+
+	if _, err := k.Open(sealed, []byte("session:b")); !errors.Is(err, ErrTamperedValue) {
+		t.Fatalf("open under another key: err = %v, want ErrTamperedValue", err)
+	}
+}
+
+func TestKeyringRejectsTampering(t *testing.T) {
+	k, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	sealed, _ := k.Seal([]byte("hello"), nil)
+
+	for _, tampered := range [][]byte{
+		append(append([]byte(nil), sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^1),
+		[]byte(`{"token":"raw json"}`),
+	} {
+		if _, err := k.Open(tampered, nil); !errors.Is(err, ErrTamperedValue) {
+			t.Errorf("Open(%q) err = %v, want ErrTamperedValue", tampered, err)
+		}
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	sealed, _ := old.Seal([]byte("hello"), nil)
+
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.Open(sealed, nil); err != nil {
+		t.Fatalf("rotated keyring can't open value sealed with old key: %v", err)
+	}
+
+	resealed, _ := rotated.Seal([]byte("hello"), nil)
+	if _, err := old.Open(resealed, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("old keyring opened value sealed with new key: err = %v", err)
+	}
+}
+
+func TestSessionManagerRejectsTamperedEntry(t *testing.T) {
+	sm := NewMemorySessionManager(SessionOptions{})
+	defer sm.Close()
+	ctx := context.Background()
+
+	if err := sm.store.Set(ctx, "oauth_state:x", []byte("true"), 0); err != nil {
+		t.Fatal(err)
+	}
+	var value bool
+	if err := sm.Get(ctx, "oauth_state:x", &value); !errors.Is(err, ErrTamperedValue) {
+		t.Fatalf("err = %v, want ErrTamperedValue", err)
+	}
+}
+
+func TestSessionManagerKeepsEntrySealedWithUnknownKey(t *testing.T) {
+	sm := NewMemorySessionManager(SessionOptions{})
+	defer sm.Close()
+	ctx := context.Background()
+
+	// 另一个实例已经换用新密钥写入了会话
+	newer, _ := NewKeyring("k2", map[string][]byte{"k2": testKey(2)})
+	sealed, _ := newer.Seal([]byte(`{}`), []byte(sessionKey("abc")))
+	if err := sm.store.Set(ctx, sessionKey("abc"), sealed, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := getSession(sm, "abc"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want ErrUnknownKey", err)
+	}
+	if _, err := sm.store.Get(ctx, sessionKey("abc")); err != nil {
+		t.Fatalf("entry was deleted: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore 是进程内的 store 实现，用于测试和单节点开发环境。
+// 过期的键在读取时被忽略，并由后台 janitor 定期清理。
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	sets    map[string]map[string]struct{}
+	stop    chan struct{}
+	once    sync.Once
+	// now 是当前时间，测试中可替换为假时钟
+	now func() time.Time
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time // 零值表示永不过期
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+func newMemoryStore(cleanupInterval time.Duration) *memoryStore {
+	s := &memoryStore{
+		entries: make(map[string]memoryEntry),
+		sets:    make(map[string]map[string]struct{}),
+		stop:    make(chan struct{}),
+		now:     time.Now,
+	}
+	go s.janitor(cleanupInterval)
+	return s
+}
+
+func (s *memoryStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *memoryStore) deleteExpired() {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *memoryStore) newEntry(value []byte, expiration time.Duration) memoryEntry {
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if expiration > 0 {
+		entry.expiresAt = s.now().Add(expiration)
+	}
+	return entry
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = s.newEntry(value, expiration)
+	return nil
+}
+
+func (s *memoryStore) SetXX(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[key]; !ok || entry.expired(s.now()) {
+		return nil
+	}
+	s.entries[key] = s.newEntry(value, expiration)
+	return nil
+}
+
+func (s *memoryStore) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[key]; ok && !entry.expired(s.now()) {
+		return false, nil
+	}
+	s.entries[key] = s.newEntry(value, expiration)
+	return true, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || entry.expired(s.now()) {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryStore) Replace(ctx context.Context, oldKey, newKey string, value []byte, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if oldKey != "" {
+		delete(s.entries, oldKey)
+	}
+	s.entries[newKey] = s.newEntry(value, expiration)
+	return nil
+}
+
+func (s *memoryStore) AddMember(ctx context.Context, key, member string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sets[key] == nil {
+		s.sets[key] = make(map[string]struct{})
+	}
+	s.sets[key][member] = struct{}{}
+	return nil
+}
+
+func (s *memoryStore) RemoveMember(ctx context.Context, key, member string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sets[key], member)
+	if len(s.sets[key]) == 0 {
+		delete(s.sets, key)
+	}
+	return nil
+}
+
+func (s *memoryStore) Members(ctx context.Context, key string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members := make([]string, 0, len(s.sets[key]))
+	for member := range s.sets[key] {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (s *memoryStore) CountKeys(ctx context.Context, prefix string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	count := 0
+	for key, entry := range s.entries {
+		if strings.HasPrefix(key, prefix) && !entry.expired(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
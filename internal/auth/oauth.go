@@ -1,79 +1,269 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/majiayu000/gin-starter/internal/auth/oauth"
+	"github.com/majiayu000/gin-starter/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/oauth2"
 )
 
+var (
+	ErrUnknownProvider  = errors.New("unknown provider type")
+	ErrProviderDisabled = errors.New("provider disabled")
+)
+
+// disabledProvidersKey 是共享存储中被停用的 provider 集合
+const disabledProvidersKey = "oauth:disabled_providers"
+
+// ProviderStateStore is where the set of disabled providers is kept so every
+// instance sees it. The session manager implements it.
+type ProviderStateStore interface {
+	AddToSet(ctx context.Context, key, member string) error
+	RemoveFromSet(ctx context.Context, key, member string) error
+	SetMembers(ctx context.Context, key string) ([]string, error)
+}
+
+// OAuthManager holds the OAuth providers in the order they were configured.
+// It is safe for concurrent use: providers can be replaced, enabled or
+// disabled while requests are being served.
 type OAuthManager struct {
+	mu        sync.RWMutex
 	providers map[string]oauth.Provider
+	// order 记录 provider 的配置顺序，列表按此顺序返回
+	order []string
+	// disabled 是运行时被管理员停用的 provider，有共享存储时是它的本地副本
+	disabled map[string]bool
+	store    ProviderStateStore
+}
+
+// NamedProvider is a provider with the name it is registered under.
+type NamedProvider struct {
+	Name     string
+	Provider oauth.Provider
 }
 
+// ProviderStatus describes a registered provider.
+type ProviderStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// NewOAuthManager creates a manager whose enable/disable state is kept in
+// process memory only.
 func NewOAuthManager() *OAuthManager {
+	return NewSharedOAuthManager(nil)
+}
+
+// NewSharedOAuthManager creates a manager that keeps the set of disabled
+// providers in store, so it is shared by all instances and survives
+// restarts. Other instances see a change after their next Sync.
+func NewSharedOAuthManager(store ProviderStateStore) *OAuthManager {
 	return &OAuthManager{
 		providers: make(map[string]oauth.Provider),
+		disabled:  make(map[string]bool),
+		store:     store,
 	}
 }
 
+// AddProvider registers a provider, or replaces the one registered under the
+// same name without changing its position.
 func (m *OAuthManager) AddProvider(name string, provider oauth.Provider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.providers[name]; !ok {
+		m.order = append(m.order, name)
+	}
 	m.providers[name] = provider
 }
 
+// ReplaceProviders swaps in a new set of providers at once, e.g. after the
+// config was reloaded. Requests already using an old provider finish with it.
+// Providers disabled at runtime stay disabled.
+func (m *OAuthManager) ReplaceProviders(providers []NamedProvider) {
+	replaced := make(map[string]oauth.Provider, len(providers))
+	order := make([]string, 0, len(providers))
+	for _, p := range providers {
+		if _, ok := replaced[p.Name]; !ok {
+			order = append(order, p.Name)
+		}
+		replaced[p.Name] = p.Provider
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.providers = replaced
+	m.order = order
+}
+
+// GetProvider returns an enabled provider, ErrUnknownProvider if none is
+// registered under providerType, or ErrProviderDisabled.
 func (m *OAuthManager) GetProvider(providerType string) (oauth.Provider, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	provider, ok := m.providers[providerType]
 	if !ok {
-		return nil, errors.New("unknown provider type")
+		return nil, ErrUnknownProvider
+	}
+	if m.disabled[providerType] {
+		return nil, ErrProviderDisabled
 	}
 	return provider, nil
 }
 
 func (m *OAuthManager) RemoveProvider(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.providers, name)
+	m.order = slices.DeleteFunc(m.order, func(n string) bool { return n == name })
+}
+
+// SetEnabled enables or disables a registered provider at runtime. Logins
+// through a disabled provider are rejected until it is enabled again. With a
+// shared store the change is saved there first; without one it only applies
+// to this instance and is lost on restart.
+func (m *OAuthManager) SetEnabled(ctx context.Context, name string, enabled bool) error {
+	m.mu.RLock()
+	_, ok := m.providers[name]
+	m.mu.RUnlock()
+	if !ok {
+		return ErrUnknownProvider
+	}
+
+	if m.store != nil {
+		var err error
+		if enabled {
+			err = m.store.RemoveFromSet(ctx, disabledProvidersKey, name)
+		} else {
+			err = m.store.AddToSet(ctx, disabledProvidersKey, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if enabled {
+		delete(m.disabled, name)
+	} else {
+		m.disabled[name] = true
+	}
+	return nil
 }
 
+// Sync reloads the set of disabled providers from the shared store. It does
+// nothing without a store.
+func (m *OAuthManager) Sync(ctx context.Context) error {
+	if m.store == nil {
+		return nil
+	}
+	names, err := m.store.SetMembers(ctx, disabledProvidersKey)
+	if err != nil {
+		return err
+	}
+	disabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		disabled[name] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disabled = disabled
+	return nil
+}
+
+// SyncEvery calls Sync every interval until ctx is done, so changes made on
+// other instances take effect here within interval. Errors are logged and
+// the last known state is kept.
+func (m *OAuthManager) SyncEvery(ctx context.Context, interval time.Duration) {
+	if m.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			syncCtx, cancel := context.WithTimeout(ctx, interval)
+			if err := m.Sync(syncCtx); err != nil {
+				slog.Error("failed to sync disabled OAuth providers", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Shared reports whether the enable/disable state is shared by all
+// instances.
+func (m *OAuthManager) Shared() bool {
+	return m.store != nil
+}
+
+// ListProviders returns the names of the enabled providers in configured
+// order.
 func (m *OAuthManager) ListProviders() []string {
-	providers := make([]string, 0, len(m.providers))
-	for name := range m.providers {
-		providers = append(providers, name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	providers := make([]string, 0, len(m.order))
+	for _, name := range m.order {
+		if !m.disabled[name] {
+			providers = append(providers, name)
+		}
 	}
 	return providers
 }
 
-func (m *OAuthManager) Exchange(providerType string, code string) (*oauth2.Token, error) {
-	provider, ok := m.providers[providerType]
-	if !ok {
-		return nil, errors.New("unknown provider type")
+// Providers returns every registered provider with whether it is enabled,
+// in configured order.
+func (m *OAuthManager) Providers() []ProviderStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	providers := make([]ProviderStatus, len(m.order))
+	for i, name := range m.order {
+		providers[i] = ProviderStatus{Name: name, Enabled: !m.disabled[name]}
 	}
+	return providers
+}
 
-	tokenInterface, err := provider.Exchange(code)
+func (m *OAuthManager) Exchange(ctx context.Context, providerType string, code string) (_ *oauth2.Token, err error) {
+	provider, err := m.GetProvider(providerType)
 	if err != nil {
 		return nil, err
 	}
 
-	token, ok := tokenInterface.(*oauth2.Token)
-	if !ok {
-		return nil, errors.New("invalid token type")
-	}
+	ctx, span := tracing.Start(ctx, "oauth.exchange", attribute.String("oauth.provider", providerType))
+	defer func() { tracing.End(span, err) }()
 
-	return token, nil
+	return provider.Exchange(ctx, code)
 }
 
-func (m *OAuthManager) GetUserInfo(providerType string, token *oauth2.Token) (map[string]interface{}, error) {
-	provider, ok := m.providers[providerType]
-	if !ok {
-		return nil, errors.New("unknown provider type")
+func (m *OAuthManager) GetUserInfo(ctx context.Context, providerType string, token *oauth2.Token) (_ map[string]interface{}, err error) {
+	provider, err := m.GetProvider(providerType)
+	if err != nil {
+		return nil, err
 	}
 
-	userInfo, err := provider.GetUserInfo(token)
+	ctx, span := tracing.Start(ctx, "oauth.userinfo", attribute.String("oauth.provider", providerType))
+	defer func() { tracing.End(span, err) }()
+
+	userInfo, err := provider.GetUserInfo(ctx, token)
 	if err != nil {
 		return nil, err
 	}
 
 	return map[string]interface{}{
-		"id":    userInfo.ID,
-		"name":  userInfo.Name,
-		"email": userInfo.Email,
+		"id":             userInfo.ID,
+		"name":           userInfo.Name,
+		"email":          userInfo.Email,
+		"email_verified": userInfo.EmailVerified,
 	}, nil
 }
@@ -7,13 +7,14 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
+	"github.com/majiayu000/gin-starter/internal/logger"
 	"github.com/majiayu000/gin-starter/internal/types"
 	"golang.org/x/oauth2"
 	googleOAuth2 "golang.org/x/oauth2/google"
@@ -24,6 +25,7 @@ import (
 type AppleProvider struct {
 	config         *oauth2.Config
 	sessionManager types.SessionManager
+	httpTimeout    time.Duration
 }
 
 func NewAppleProvider(config map[string]string, sessionManager types.SessionManager) (*AppleProvider, error) {
@@ -47,17 +49,24 @@ func NewAppleProvider(config map[string]string, sessionManager types.SessionMana
 		return nil, errors.New("Apple client ID is missing")
 	}
 
-	token, nil := generateToken(privateKey, teamID, clientID)
+	token, err := generateToken(privateKey, keyID, clientID, teamID)
+	if err != nil {
+		return nil, err
+	}
 
 	redirectURL, ok := config["redirect_url"]
 	if !ok {
 		return nil, errors.New("Apple redirect URL is missing")
 	}
 
+	timeout, err := httpTimeout(config)
+	if err != nil {
+		return nil, err
+	}
+
 	oauthConfig := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: token,
-		KeyID:        keyID,
 		RedirectURL:  redirectURL,
 		Scopes: []string{
 			"https://www.googleapis.com/auth/userinfo.email",
@@ -66,11 +75,13 @@ func NewAppleProvider(config map[string]string, sessionManager types.SessionMana
 		Endpoint: googleOAuth2.Endpoint,
 	}
 
-	log.Printf("Apple OAuth config initialized: %+v", oauthConfig)
+	// 不记录整个 oauth2.Config，其中包含 client secret
+	slog.Debug("Apple OAuth config initialized", "client_id", oauthConfig.ClientID, "redirect_url", oauthConfig.RedirectURL)
 
 	return &AppleProvider{
 		config:         oauthConfig,
 		sessionManager: sessionManager,
+		httpTimeout:    timeout,
 	}, nil
 
 	// return &Apple{
@@ -86,39 +97,32 @@ func NewAppleProvider(config map[string]string, sessionManager types.SessionMana
 	// }
 }
 
+// GetAuthURL returns the provider's consent page URL. The caller is
+// responsible for storing state.
 func (p *AppleProvider) GetAuthURL(state string) string {
-	// 生成一个随机状态
-
-	// 将状态保存到 session
-	err := p.sessionManager.Set(context.Background(), "oauth_state:"+state, true, 10*time.Minute)
-	if err != nil {
-		log.Printf("Error saving state: %v", err)
-		return ""
-	}
-	// 返回包含状态的 URL
 	return p.config.AuthCodeURL(state)
 }
 
-func generateToken(file string, clientID string, teamID string) (string, error) {
+func generateToken(file string, keyID string, clientID string, teamID string) (string, error) {
 	privateKeyData, err := os.ReadFile(file)
 	if err != nil {
-		log.Fatalf("无法读取私钥文件: %v", err)
+		return "", fmt.Errorf("无法读取私钥文件: %w", err)
 	}
 
 	// 解析私钥
 	block, _ := pem.Decode(privateKeyData)
 	if block == nil {
-		log.Fatalf("无法解码 PEM 块")
+		return "", errors.New("无法解码 PEM 块")
 	}
 
 	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
-		log.Fatalf("无法解析私钥: %v", err)
+		return "", fmt.Errorf("无法解析私钥: %w", err)
 	}
 
 	ecdsaKey, ok := privateKey.(*ecdsa.PrivateKey)
 	if !ok {
-		log.Fatalf("私钥不是有效的 ECDSA 私钥")
+		return "", errors.New("私钥不是有效的 ECDSA 私钥")
 	}
 
 	// 设置 JWT 声明
@@ -132,24 +136,22 @@ func generateToken(file string, clientID string, teamID string) (string, error)
 
 	// 创建 token
 	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
-	token.Header["kid"] = "YOUR_KEY_ID"
+	token.Header["kid"] = keyID
 
 	// 签名并获取完整的编码后的字符串 token
 	tokenString, err := token.SignedString(ecdsaKey)
 	if err != nil {
-		log.Fatalf("无法签名 token: %v", err)
+		return "", fmt.Errorf("无法签名 token: %w", err)
 	}
 
 	return tokenString, nil
 
 }
 
-func (p *AppleProvider) Exchange(code string) (interface{}, error) {
-	token, err := p.config.Exchange(context.Background(), code)
-	if err != nil {
-		return nil, err
-	}
-	return token, nil
+func (p *AppleProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	ctx, cancel := callContext(ctx, p.httpTimeout)
+	defer cancel()
+	return p.config.Exchange(ctx, code)
 }
 
 func (p *AppleProvider) GetLoginHandler() gin.HandlerFunc {
@@ -157,47 +159,45 @@ func (p *AppleProvider) GetLoginHandler() gin.HandlerFunc {
 		state := generateRandomState()
 		err := p.sessionManager.Set(c.Request.Context(), "oauth_state:"+state, true, 10*time.Minute)
 		if err != nil {
-			log.Printf("Error setting state in Redis: %v", err)
+			logger.FromContext(c.Request.Context()).Error("failed to store OAuth state", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize login"})
 			return
 		}
 
 		url := p.GetAuthURL(state)
-		log.Printf("Redirecting to auth URL: %s", url)
 		c.Redirect(http.StatusFound, url)
 	}
 }
 
 func (p *AppleProvider) GetCallbackHandler(successHandler http.Handler) gin.HandlerFunc {
-
-	fmt.Println("CAaAAAAAAAAAA")
 	return func(c *gin.Context) {
 		// Implementation remains the same
 	}
 }
 
-func (p *AppleProvider) GetUserInfo(token interface{}) (*UserInfo, error) {
-	oauthToken, ok := token.(*oauth2.Token)
-	if !ok {
-		return nil, errors.New("invalid token type for Google provider")
+func (p *AppleProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error) {
+	if token == nil {
+		return nil, errors.New("missing token")
 	}
 
-	ctx := context.Background()
-	client := p.config.Client(ctx, oauthToken)
+	ctx, cancel := callContext(ctx, p.httpTimeout)
+	defer cancel()
+	client := p.config.Client(ctx, token)
 
 	service, err := googleauth.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return nil, err
 	}
 
-	userInfo, err := service.Userinfo.Get().Do()
+	userInfo, err := service.Userinfo.Get().Context(ctx).Do()
 	if err != nil {
 		return nil, err
 	}
 
 	return &UserInfo{
-		ID:    userInfo.Id,
-		Name:  userInfo.Name,
-		Email: userInfo.Email,
+		ID:            userInfo.Id,
+		Name:          userInfo.Name,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.VerifiedEmail != nil && *userInfo.VerifiedEmail,
 	}, nil
 }
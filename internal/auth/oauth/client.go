@@ -0,0 +1,39 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/oauth2"
+)
+
+// DefaultHTTPTimeout bounds each HTTP call to a provider when the provider
+// config has no http_timeout.
+const DefaultHTTPTimeout = 10 * time.Second
+
+// httpClient 是所有 provider 调用共用的客户端，每个请求都会生成一个 client span
+var httpClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// httpTimeout 读取 provider 配置中的 http_timeout，例如 "5s"
+func httpTimeout(config map[string]string) (time.Duration, error) {
+	value := config["http_timeout"]
+	if value == "" {
+		return DefaultHTTPTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid http_timeout %q", value)
+	}
+	return timeout, nil
+}
+
+// callContext returns the context for one provider HTTP call: it is
+// cancelled when ctx is, times out after timeout and makes oauth2 use the
+// traced HTTP client.
+func callContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	return context.WithTimeout(ctx, timeout)
+}
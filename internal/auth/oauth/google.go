@@ -5,13 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/majiayu000/gin-starter/internal/logger"
 	"github.com/majiayu000/gin-starter/internal/types"
 	"golang.org/x/oauth2"
 	googleOAuth2 "golang.org/x/oauth2/google"
@@ -22,6 +22,7 @@ import (
 type GoogleProvider struct {
 	config         *oauth2.Config
 	sessionManager types.SessionManager
+	httpTimeout    time.Duration
 }
 
 // Google login errors
@@ -46,6 +47,11 @@ func NewGoogleProvider(config map[string]string, sessionManager types.SessionMan
 		return nil, errors.New("Google redirect URL is missing")
 	}
 
+	timeout, err := httpTimeout(config)
+	if err != nil {
+		return nil, err
+	}
+
 	oauthConfig := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
@@ -57,33 +63,26 @@ func NewGoogleProvider(config map[string]string, sessionManager types.SessionMan
 		Endpoint: googleOAuth2.Endpoint,
 	}
 
-	log.Printf("Google OAuth config initialized: %+v", oauthConfig)
+	// 不记录整个 oauth2.Config，其中包含 client secret
+	slog.Debug("Google OAuth config initialized", "client_id", oauthConfig.ClientID, "redirect_url", oauthConfig.RedirectURL)
 
 	return &GoogleProvider{
 		config:         oauthConfig,
 		sessionManager: sessionManager,
+		httpTimeout:    timeout,
 	}, nil
 }
 
+// GetAuthURL returns the provider's consent page URL. The caller is
+// responsible for storing state.
 func (p *GoogleProvider) GetAuthURL(state string) string {
-	// 生成一个随机状态
-
-	// 将状态保存到 session
-	err := p.sessionManager.Set(context.Background(), "oauth_state:"+state, true, 10*time.Minute)
-	if err != nil {
-		log.Printf("Error saving state: %v", err)
-		return ""
-	}
-	// 返回包含状态的 URL
 	return p.config.AuthCodeURL(state)
 }
 
-func (p *GoogleProvider) Exchange(code string) (interface{}, error) {
-	token, err := p.config.Exchange(context.Background(), code)
-	if err != nil {
-		return nil, err
-	}
-	return token, nil
+func (p *GoogleProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	ctx, cancel := callContext(ctx, p.httpTimeout)
+	defer cancel()
+	return p.config.Exchange(ctx, code)
 }
 
 func (p *GoogleProvider) GetLoginHandler() gin.HandlerFunc {
@@ -91,13 +90,12 @@ func (p *GoogleProvider) GetLoginHandler() gin.HandlerFunc {
 		state := generateRandomState()
 		err := p.sessionManager.Set(c.Request.Context(), "oauth_state:"+state, true, 10*time.Minute)
 		if err != nil {
-			log.Printf("Error setting state in Redis: %v", err)
+			logger.FromContext(c.Request.Context()).Error("failed to store OAuth state", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize login"})
 			return
 		}
 
 		url := p.GetAuthURL(state)
-		log.Printf("Redirecting to auth URL: %s", url)
 		c.Redirect(http.StatusFound, url)
 	}
 }
@@ -109,35 +107,34 @@ func generateRandomState() string {
 }
 
 func (p *GoogleProvider) GetCallbackHandler(successHandler http.Handler) gin.HandlerFunc {
-
-	fmt.Println("CAaAAAAAAAAAA")
 	return func(c *gin.Context) {
 		// Implementation remains the same
 	}
 }
 
-func (p *GoogleProvider) GetUserInfo(token interface{}) (*UserInfo, error) {
-	oauthToken, ok := token.(*oauth2.Token)
-	if !ok {
-		return nil, errors.New("invalid token type for Google provider")
+func (p *GoogleProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error) {
+	if token == nil {
+		return nil, errors.New("missing token")
 	}
 
-	ctx := context.Background()
-	client := p.config.Client(ctx, oauthToken)
+	ctx, cancel := callContext(ctx, p.httpTimeout)
+	defer cancel()
+	client := p.config.Client(ctx, token)
 
 	service, err := googleauth.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return nil, err
 	}
 
-	userInfo, err := service.Userinfo.Get().Do()
+	userInfo, err := service.Userinfo.Get().Context(ctx).Do()
 	if err != nil {
 		return nil, err
 	}
 
 	return &UserInfo{
-		ID:    userInfo.Id,
-		Name:  userInfo.Name,
-		Email: userInfo.Email,
+		ID:            userInfo.Id,
+		Name:          userInfo.Name,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.VerifiedEmail != nil && *userInfo.VerifiedEmail,
 	}, nil
 }
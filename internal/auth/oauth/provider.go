@@ -1,25 +1,32 @@
 package oauth
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/majiayu000/gin-starter/internal/types"
+	"golang.org/x/oauth2"
 )
 
 type UserInfo struct {
 	ID    string
 	Name  string
 	Email string
+	// EmailVerified 表示 provider 已确认用户拥有该邮箱
+	EmailVerified bool
 }
 
+// Provider is an OAuth identity provider. Exchange and GetUserInfo make
+// HTTP calls to the provider; they return when ctx is done or the
+// provider's HTTP timeout expires, whichever comes first.
 type Provider interface {
 	GetAuthURL(state string) string
-	Exchange(code string) (interface{}, error)
+	Exchange(ctx context.Context, code string) (*oauth2.Token, error)
 	GetLoginHandler() gin.HandlerFunc
 	GetCallbackHandler(successHandler http.Handler) gin.HandlerFunc
-	GetUserInfo(token interface{}) (*UserInfo, error)
+	GetUserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error)
 }
 
 type ProviderType string
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestOAuthManagerOrderAndDisable(t *testing.T) {
+	m := NewOAuthManager()
+	for _, name := range []string{"google", "apple", "github"} {
+		m.AddProvider(name, nil)
+	}
+	// 重复注册不改变顺序
+	m.AddProvider("google", nil)
+
+	for i := 0; i < 10; i++ {
+		if got := m.ListProviders(); !slices.Equal(got, []string{"google", "apple", "github"}) {
+			t.Fatalf("ListProviders() = %v", got)
+		}
+	}
+
+	if err := m.SetEnabled(context.Background(), "apple", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetProvider("apple"); !errors.Is(err, ErrProviderDisabled) {
+		t.Fatalf("GetProvider(disabled) error = %v", err)
+	}
+	if got := m.ListProviders(); !slices.Equal(got, []string{"google", "github"}) {
+		t.Fatalf("ListProviders() = %v", got)
+	}
+	if err := m.SetEnabled(context.Background(), "gitlab", false); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("SetEnabled(unknown) error = %v", err)
+	}
+
+	// 重新加载配置后，仍存在的 provider 保持停用
+	m.ReplaceProviders([]NamedProvider{{Name: "apple"}, {Name: "google"}})
+	want := []ProviderStatus{{Name: "apple", Enabled: false}, {Name: "google", Enabled: true}}
+	if got := m.Providers(); !slices.Equal(got, want) {
+		t.Fatalf("Providers() = %v, want %v", got, want)
+	}
+
+	if err := m.SetEnabled(context.Background(), "apple", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetProvider("apple"); err != nil {
+		t.Fatalf("GetProvider(enabled) error = %v", err)
+	}
+}
+
+func TestOAuthManagerConcurrentUse(t *testing.T) {
+	m := NewOAuthManager()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("p%d", i%3)
+			for j := 0; j < 200; j++ {
+				switch j % 5 {
+				case 0:
+					m.AddProvider(name, nil)
+				case 1:
+					m.SetEnabled(context.Background(), name, j%2 == 0)
+				case 2:
+					m.ReplaceProviders([]NamedProvider{{Name: name}})
+				case 3:
+					m.RemoveProvider(name)
+				default:
+					m.GetProvider(name)
+					m.ListProviders()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestOAuthManagerSharedState(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySessionManager(SessionOptions{})
+	t.Cleanup(func() { store.Close() })
+
+	// 两个实例共享同一个存储
+	a, b := NewSharedOAuthManager(store), NewSharedOAuthManager(store)
+	for _, m := range []*OAuthManager{a, b} {
+		m.AddProvider("google", nil)
+		m.AddProvider("apple", nil)
+	}
+
+	if err := a.SetEnabled(ctx, "apple", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetProvider("apple"); !errors.Is(err, ErrProviderDisabled) {
+		t.Fatalf("other instance: GetProvider(disabled) error = %v", err)
+	}
+
+	// 重启后的实例从存储中恢复停用状态
+	restarted := NewSharedOAuthManager(store)
+	restarted.AddProvider("apple", nil)
+	if err := restarted.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.GetProvider("apple"); !errors.Is(err, ErrProviderDisabled) {
+		t.Fatalf("after restart: GetProvider(disabled) error = %v", err)
+	}
+
+	if err := b.SetEnabled(ctx, "apple", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetProvider("apple"); err != nil {
+		t.Fatalf("GetProvider(enabled) error = %v", err)
+	}
+}
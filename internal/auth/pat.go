@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/types"
+)
+
+// PATPrefix marks personal access tokens, so they can be told apart from JWT
+// access tokens in an Authorization header.
+const PATPrefix = "pat_"
+
+// Scopes a personal access token can be granted.
+const (
+	ScopeProfileRead = "profile:read"
+	ScopeSearchRead  = "search:read"
+)
+
+var knownScopes = map[string]bool{
+	ScopeProfileRead: true,
+	ScopeSearchRead:  true,
+}
+
+var (
+	ErrInvalidPAT    = errors.New("invalid personal access token")
+	ErrPATNotFound   = errors.New("personal access token not found")
+	ErrInvalidScope  = errors.New("invalid scope")
+	ErrInvalidExpiry = errors.New("invalid expiry")
+)
+
+// PersonalAccessToken describes a token without its secret.
+type PersonalAccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// patRecord 是 token 在存储中的内容，只保存 secret 的哈希
+type patRecord struct {
+	PersonalAccessToken
+	SecretHash string                 `json:"secret_hash"`
+	UserInfo   map[string]interface{} `json:"user_info"`
+}
+
+// PATOptions configures a PATService.
+type PATOptions struct {
+	// MaxLifetime 是 token 的最长有效期，也是未指定过期时间时的默认值
+	MaxLifetime time.Duration
+	// TouchInterval 限制 last_used_at 的更新频率
+	TouchInterval time.Duration
+}
+
+// PATService manages user-created personal access tokens for scripted API
+// access. Tokens have the form pat_<id>_<secret>; only a hash of the secret
+// is stored, so a token can be shown only once, when it is created.
+type PATService struct {
+	sm      types.SessionManager
+	options PATOptions
+}
+
+func NewPATService(sm types.SessionManager, options PATOptions) *PATService {
+	if options.MaxLifetime <= 0 {
+		options.MaxLifetime = 365 * 24 * time.Hour
+	}
+	if options.TouchInterval <= 0 {
+		options.TouchInterval = time.Minute
+	}
+	return &PATService{sm: sm, options: options}
+}
+
+// Create issues a new token for the user and returns it together with the
+// plain text token. expiresAt may be zero to use the maximum lifetime.
+func (s *PATService) Create(ctx context.Context, userInfo map[string]interface{}, name string, scopes []string, expiresAt time.Time) (*PersonalAccessToken, string, error) {
+	userID := stringClaim(userInfo, "id")
+	if userID == "" {
+		return nil, "", errors.New("user ID is missing")
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	maxExpiresAt := now.Add(s.options.MaxLifetime)
+	if expiresAt.IsZero() {
+		expiresAt = maxExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.After(maxExpiresAt) {
+		return nil, "", fmt.Errorf("%w: must be within %s from now", ErrInvalidExpiry, s.options.MaxLifetime)
+	}
+
+	id := randomHex(8)
+	secret := randomSecret()
+	record := patRecord{
+		PersonalAccessToken: PersonalAccessToken{
+			ID:        id,
+			Name:      name,
+			Scopes:    scopes,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		},
+		SecretHash: hashToken(secret),
+		UserInfo:   userInfo,
+	}
+
+	if err := s.sm.Set(ctx, patKey(id), record, expiresAt.Sub(now)); err != nil {
+		return nil, "", fmt.Errorf("failed to save token: %w", err)
+	}
+	if err := s.sm.AddToSet(ctx, patUserKey(userID), id); err != nil {
+		s.sm.Delete(ctx, patKey(id))
+		return nil, "", fmt.Errorf("failed to save token: %w", err)
+	}
+
+	return &record.PersonalAccessToken, PATPrefix + id + "_" + secret, nil
+}
+
+// List returns the user's live tokens, newest first.
+func (s *PATService) List(ctx context.Context, userID string) ([]PersonalAccessToken, error) {
+	ids, err := s.sm.SetMembers(ctx, patUserKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]PersonalAccessToken, 0, len(ids))
+	for _, id := range ids {
+		var record patRecord
+		err := s.sm.Get(ctx, patKey(id), &record)
+		if errors.Is(err, ErrKeyNotFound) {
+			// token 已过期，顺便清理索引
+			s.sm.RemoveFromSet(ctx, patUserKey(userID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, record.PersonalAccessToken)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// Revoke deletes one of the user's tokens.
+func (s *PATService) Revoke(ctx context.Context, userID, id string) error {
+	var record patRecord
+	if err := s.sm.Get(ctx, patKey(id), &record); err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return ErrPATNotFound
+		}
+		return err
+	}
+	if stringClaim(record.UserInfo, "id") != userID {
+		return ErrPATNotFound
+	}
+
+	if err := s.sm.Delete(ctx, patKey(id)); err != nil {
+		return err
+	}
+	return s.sm.RemoveFromSet(ctx, patUserKey(userID), id)
+}
+
+// Verify checks a plain text token and returns the owner's user info and
+// the token's scopes.
+func (s *PATService) Verify(ctx context.Context, token string) (map[string]interface{}, []string, error) {
+	rest, ok := strings.CutPrefix(token, PATPrefix)
+	if !ok {
+		return nil, nil, ErrInvalidPAT
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, nil, ErrInvalidPAT
+	}
+
+	key := patKey(id)
+	var record patRecord
+	if err := s.sm.Get(ctx, key, &record); err != nil {
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrTamperedValue) || errors.Is(err, ErrUnknownKey) {
+			return nil, nil, ErrInvalidPAT
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(record.SecretHash)) != 1 || !now.Before(record.ExpiresAt) {
+		return nil, nil, ErrInvalidPAT
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= s.options.TouchInterval {
+		record.LastUsedAt = &now
+		if err := s.sm.SetXX(ctx, key, record, record.ExpiresAt.Sub(now)); err != nil {
+			logger.FromContext(ctx).Error("failed to update token last used time", "error", err)
+		}
+	}
+
+	return record.UserInfo, record.Scopes, nil
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	seen := make(map[string]bool, len(scopes))
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !knownScopes[scope] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func patKey(id string) string {
+	return "pat:" + id
+}
+
+func patUserKey(userID string) string {
+	return "pat_user:" + userID
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func randomSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -2,32 +2,24 @@ package auth
 
 import (
 	"context"
-	"encoding/gob"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"strings"
 	"time"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
+	"github.com/majiayu000/gin-starter/internal/logger"
 	"github.com/majiayu000/gin-starter/internal/types"
 	"github.com/redis/go-redis/v9"
 
 	"golang.org/x/oauth2"
 )
 
-type SessionInfo struct {
-	AccessToken string
-	TokenType   string
-	Expiry      time.Time
-	UserID      string
-	UserName    string
-	Email       string
-	// 其他必要的用户信息字段
-}
-
 type Session struct {
 	AccessToken string
 	TokenType   string
@@ -40,136 +32,351 @@ type Session struct {
 	ExpiresAt   time.Time `json:"expires_at"`
 }
 
+// SessionCookieName 是保存会话 ID 的 cookie 名称
+const SessionCookieName = "session_id"
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+)
+
+// SessionOptions controls how long sessions live.
+type SessionOptions struct {
+	// IdleTimeout 是会话在无访问情况下的存活时间
+	IdleTimeout time.Duration
+	// MaxLifetime 是会话从创建起的绝对最长存活时间
+	MaxLifetime time.Duration
+	// TouchInterval 是两次顺延之间的最小间隔
+	TouchInterval time.Duration
+	// CleanupInterval 是内存存储清理过期数据的间隔，默认为一分钟，
+	// 但不超过 IdleTimeout；Redis 自行处理过期
+	CleanupInterval time.Duration
+	// Keyring 用于加密存储的值；为空时使用随机密钥，重启后已有数据将无法读取
+	Keyring *Keyring
+	// Cookie 是会话 cookie 的属性
+	Cookie CookieOptions
+}
+
+// CookieOptions holds the attributes of the session cookie.
+type CookieOptions struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// ParseSameSite converts a config value ("lax", "strict" or "none") to an
+// http.SameSite mode.
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("invalid SameSite mode %q", value)
+	}
+}
+
+func (o SessionOptions) withDefaults() SessionOptions {
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = 30 * time.Minute
+	}
+	if o.MaxLifetime <= 0 {
+		o.MaxLifetime = 24 * time.Hour
+	}
+	if o.TouchInterval <= 0 {
+		o.TouchInterval = time.Minute
+	}
+	if o.CleanupInterval <= 0 {
+		o.CleanupInterval = min(time.Minute, o.IdleTimeout)
+	}
+	if o.Keyring == nil {
+		o.Keyring = NewRandomKeyring()
+	}
+	if o.Cookie.SameSite == 0 {
+		o.Cookie.SameSite = http.SameSiteLaxMode
+	}
+	return o
+}
+
+// sessionData 是存储在 Redis 中的会话内容
+type sessionData struct {
+	Token      *oauth2.Token          `json:"token"`
+	UserInfo   map[string]interface{} `json:"user_info"`
+	CreatedAt  time.Time              `json:"created_at"`
+	LastSeenAt time.Time              `json:"last_seen_at"`
+}
+
 type SessionManager struct {
-	redisClient *redis.Client
+	store   store
+	options SessionOptions
+	// now 是当前时间，测试中可替换为假时钟
+	now func() time.Time
+}
+
+var _ types.SessionManager = (*SessionManager)(nil)
+
+// NewSessionManager creates a SessionManager backed by Redis.
+func NewSessionManager(redisOptions *redis.Options, options SessionOptions) *SessionManager {
+	return &SessionManager{
+		store:   &redisStore{client: redis.NewClient(redisOptions)},
+		options: options.withDefaults(),
+		now:     time.Now,
+	}
 }
 
-func NewSessionManager(redisAddr, redisPassword string, redisDB int) types.SessionManager {
+// NewMemorySessionManager creates a SessionManager that keeps everything in
+// process memory. Data is lost on restart and not shared between instances,
+// so it is only meant for tests and single-node development.
+func NewMemorySessionManager(options SessionOptions) *SessionManager {
+	options = options.withDefaults()
 	return &SessionManager{
-		redisClient: redis.NewClient(&redis.Options{
-			Addr:     redisAddr,
-			Password: redisPassword,
-			DB:       redisDB,
-		}),
+		store:   newMemoryStore(options.CleanupInterval),
+		options: options,
+		now:     time.Now,
 	}
 }
 
 func (sm *SessionManager) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	jsonValue, err := json.Marshal(value)
+	sealed, err := sm.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return sm.store.Set(ctx, key, sealed, expiration)
+}
+
+// SetXX stores value under key only if the key already exists, so an
+// update can't bring back a value that was deleted concurrently.
+func (sm *SessionManager) SetXX(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	sealed, err := sm.encode(key, value)
 	if err != nil {
 		return err
 	}
-	return sm.redisClient.Set(ctx, key, jsonValue, expiration).Err()
+	return sm.store.SetXX(ctx, key, sealed, expiration)
 }
 
+// SetNX stores value under key only if the key does not exist yet and
+// reports whether it was stored.
+func (sm *SessionManager) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	sealed, err := sm.encode(key, value)
+	if err != nil {
+		return false, err
+	}
+	return sm.store.SetNX(ctx, key, sealed, expiration)
+}
+
+// Get loads and decrypts the value stored under key. Values that fail the
+// integrity check are rejected with ErrTamperedValue, and values sealed with
+// a key that is not in the ring with ErrUnknownKey.
 func (sm *SessionManager) Get(ctx context.Context, key string, value interface{}) error {
-	jsonValue, err := sm.redisClient.Get(ctx, key).Result()
+	sealed, err := sm.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return sm.decode(key, sealed, value)
+}
+
+// encode 将值序列化为 JSON 并加密。存储键作为附加数据参与认证，
+// 因此一个条目无法被复制到其他键下使用。
+func (sm *SessionManager) encode(key string, value interface{}) ([]byte, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return sm.options.Keyring.Seal(jsonValue, []byte(key))
+}
+
+func (sm *SessionManager) decode(key string, sealed []byte, value interface{}) error {
+	jsonValue, err := sm.options.Keyring.Open(sealed, []byte(key))
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal([]byte(jsonValue), value)
+	return json.Unmarshal(jsonValue, value)
 }
 
 func (sm *SessionManager) Delete(ctx context.Context, key string) error {
-	return sm.redisClient.Del(ctx, key).Err()
+	return sm.store.Delete(ctx, key)
 }
 
-func IssueSession(c *gin.Context, token *oauth2.Token, userInfo map[string]interface{}) (string, error) {
-	session := sessions.Default(c)
+// AddToSet adds member to the set stored under key. Members are stored in
+// plain text and must not be secrets.
+func (sm *SessionManager) AddToSet(ctx context.Context, key, member string) error {
+	return sm.store.AddMember(ctx, key, member)
+}
 
-	sessionInfo := SessionInfo{
-		AccessToken: token.AccessToken,
-		TokenType:   token.TokenType,
-		Expiry:      token.Expiry,
-		UserID:      userInfo["id"].(string),
-		UserName:    userInfo["name"].(string),
-		Email:       userInfo["email"].(string),
-		// 设置其他必要的用户信息
-	}
+// RemoveFromSet removes member from the set stored under key.
+func (sm *SessionManager) RemoveFromSet(ctx context.Context, key, member string) error {
+	return sm.store.RemoveMember(ctx, key, member)
+}
 
-	session.Set("session_info", sessionInfo)
+// SetMembers returns the members of the set stored under key.
+func (sm *SessionManager) SetMembers(ctx context.Context, key string) ([]string, error) {
+	return sm.store.Members(ctx, key)
+}
 
-	if err := session.Save(); err != nil {
-		log.Printf("Failed to save session: %v", err)
-		return "", fmt.Errorf("failed to save session: %w", err)
+// RedisClient returns the Redis client sessions are stored with, or nil
+// when the manager is backed by memory.
+func (sm *SessionManager) RedisClient() *redis.Client {
+	if rs, ok := sm.store.(*redisStore); ok {
+		return rs.client
 	}
+	return nil
+}
 
-	// 立即尝试检索会话信息
-	checkSessionInfo := session.Get("session_info")
-	if checkSessionInfo == nil {
-		log.Println("Warning: Session info not found immediately after saving")
-		return "", fmt.Errorf("session info not found after saving")
-	}
+// CountSessions returns the number of live sessions. With Redis this scans
+// the keyspace, so it is meant for periodic metrics, not request paths.
+func (sm *SessionManager) CountSessions(ctx context.Context) (int, error) {
+	return sm.store.CountKeys(ctx, sessionKeyPrefix)
+}
+
+// Ping checks that the underlying store is reachable.
+func (sm *SessionManager) Ping(ctx context.Context) error {
+	return sm.store.Ping(ctx)
+}
+
+// Close releases the underlying store.
+func (sm *SessionManager) Close() error {
+	return sm.store.Close()
+}
 
-	sessionID := session.ID()
-	if sessionID == "" {
-		log.Println("Warning: Session ID is empty")
-		return "", fmt.Errorf("empty session ID")
+// CreateSession stores a new session for the user and returns its ID.
+func (sm *SessionManager) CreateSession(ctx context.Context, token *oauth2.Token, userInfo map[string]interface{}) (string, error) {
+	return sm.RotateSession(ctx, "", token, userInfo)
+}
+
+// RotateSession replaces the session oldID with a new session holding token
+// and userInfo and returns the new ID. The old session is deleted in the same
+// transaction, so an ID known before a privilege change (login, role grant,
+// account link) can never be used after it. An empty or unknown oldID simply
+// creates a new session.
+func (sm *SessionManager) RotateSession(ctx context.Context, oldID string, token *oauth2.Token, userInfo map[string]interface{}) (string, error) {
+	now := sm.now()
+	data := sessionData{
+		Token:      token,
+		UserInfo:   userInfo,
+		CreatedAt:  now,
+		LastSeenAt: now,
 	}
 
-	log.Printf("Issuing new session. Session ID: %s", sessionID)
-	log.Printf("Session info saved successfully: %+v", checkSessionInfo)
+	sessionID := generateSessionID()
+	newKey := sessionKey(sessionID)
+	sealed, err := sm.encode(newKey, data)
+	if err != nil {
+		return "", err
+	}
 
+	oldKey := ""
+	if oldID != "" {
+		oldKey = sessionKey(oldID)
+	}
+	if err := sm.store.Replace(ctx, oldKey, newKey, sealed, sm.ttl(now, now)); err != nil {
+		return "", fmt.Errorf("failed to save session: %w", err)
+	}
 	return sessionID, nil
 }
-func init() {
-	gob.Register(SessionInfo{})
+
+// DeleteSession invalidates the session with the given ID.
+func (sm *SessionManager) DeleteSession(ctx context.Context, sessionID string) error {
+	return sm.Delete(ctx, sessionKey(sessionID))
 }
 
-func (sm SessionManager) GetSession(c *gin.Context) (*oauth2.Token, map[string]interface{}, error) {
-	sessionID, err := c.Cookie("session_id")
+// GetSession loads the session referenced by the request cookie. Sessions
+// past their idle timeout or absolute lifetime are rejected with
+// ErrSessionExpired; otherwise the idle timeout is extended, at most once
+// per TouchInterval.
+func (sm *SessionManager) GetSession(c *gin.Context) (*oauth2.Token, map[string]interface{}, error) {
+	sessionID, err := c.Cookie(SessionCookieName)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	log.Printf("GET SESSION Retrieving session. Session ID: %s", sessionID)
-	var sessionData map[string]interface{}
-	err = sm.Get(c.Request.Context(), "session:"+sessionID, &sessionData)
-	if err != nil {
+	ctx := c.Request.Context()
+	key := sessionKey(sessionID)
+
+	var data sessionData
+	if err := sm.Get(ctx, key, &data); err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, nil, ErrSessionNotFound
+		}
+		if errors.Is(err, ErrTamperedValue) {
+			// 无法通过校验的会话直接删除
+			logger.FromContext(ctx).Warn("rejected tampered session entry")
+			sm.Delete(ctx, key)
+		}
+		if errors.Is(err, ErrUnknownKey) {
+			// 可能是其他实例用新密钥写入的，保留数据
+			logger.FromContext(ctx).Warn("session sealed with an unknown key")
+		}
 		return nil, nil, err
 	}
-
-	if sessionData == nil {
-		return nil, nil, errors.New("session data not found")
+	if data.Token == nil || data.UserInfo == nil {
+		return nil, nil, errors.New("invalid session data")
 	}
 
-	// 从 sessionData 中提取 token 信息
-	tokenData, ok := sessionData["token"].(map[string]interface{})
-	if !ok {
-		return nil, nil, errors.New("invalid token data in session")
+	now := sm.now()
+	if now.Sub(data.CreatedAt) >= sm.options.MaxLifetime || now.Sub(data.LastSeenAt) >= sm.options.IdleTimeout {
+		if err := sm.Delete(ctx, key); err != nil {
+			logger.FromContext(ctx).Error("failed to delete expired session", "error", err)
+		}
+		return nil, nil, ErrSessionExpired
 	}
 
-	// 重构 oauth2.Token
-	token := &oauth2.Token{
-		AccessToken: tokenData["access_token"].(string),
-		TokenType:   tokenData["token_type"].(string),
+	// 顺延空闲过期时间，但不超过绝对过期时间
+	if now.Sub(data.LastSeenAt) >= sm.options.TouchInterval {
+		data.LastSeenAt = now
+		if err := sm.touch(ctx, key, data); err != nil {
+			logger.FromContext(ctx).Error("failed to renew session", "error", err)
+		}
 	}
 
-	// 处理 expiry
-	if expiryStr, ok := tokenData["expiry"].(string); ok {
-		expiry, err := time.Parse(time.RFC3339, expiryStr)
-		if err != nil {
-			return nil, nil, fmt.Errorf("invalid expiry format: %v", err)
-		}
-		token.Expiry = expiry
-	} else {
-		// 如果 expiry 不是字符串，可能是数字类型
-		if expiryFloat, ok := tokenData["expiry"].(float64); ok {
-			token.Expiry = time.Unix(int64(expiryFloat), 0)
-		} else {
-			return nil, nil, errors.New("expiry is neither string nor float64")
-		}
+	return data.Token, data.UserInfo, nil
+}
+
+// touch rewrites the session only if it still exists, so a renewal racing
+// with a rotation or logout can't bring the old session back.
+func (sm *SessionManager) touch(ctx context.Context, key string, data sessionData) error {
+	sealed, err := sm.encode(key, data)
+	if err != nil {
+		return err
 	}
+	return sm.store.SetXX(ctx, key, sealed, sm.ttl(data.CreatedAt, data.LastSeenAt))
+}
+
+// SetCookie writes the session cookie. Its max age is the session's absolute
+// lifetime; the idle timeout is enforced server side.
+func (sm *SessionManager) SetCookie(c *gin.Context, sessionID string) {
+	c.SetSameSite(sm.options.Cookie.SameSite)
+	c.SetCookie(SessionCookieName, sessionID, int(sm.options.MaxLifetime.Seconds()), "/", sm.options.Cookie.Domain, sm.options.Cookie.Secure, true)
+}
+
+// ClearCookie removes the session cookie from the browser.
+func (sm *SessionManager) ClearCookie(c *gin.Context) {
+	c.SetSameSite(sm.options.Cookie.SameSite)
+	c.SetCookie(SessionCookieName, "", -1, "/", sm.options.Cookie.Domain, sm.options.Cookie.Secure, true)
+}
 
-	// 从 sessionData 中提取 user_info
-	userInfo, ok := sessionData["user_info"].(map[string]interface{})
-	if !ok {
-		return nil, nil, errors.New("invalid user info in session")
+// ttl returns how long a session created at createdAt may live from now on.
+func (sm *SessionManager) ttl(createdAt, now time.Time) time.Duration {
+	remaining := createdAt.Add(sm.options.MaxLifetime).Sub(now)
+	if remaining < sm.options.IdleTimeout {
+		return remaining
 	}
+	return sm.options.IdleTimeout
+}
+
+const sessionKeyPrefix = "session:"
 
-	fmt.Println("name is ", userInfo["name"])
+// sessionKey 只保存 cookie 值的哈希，Redis 中的数据无法直接被当作 cookie 重放
+func sessionKey(sessionID string) string {
+	return sessionKeyPrefix + hashToken(sessionID)
+}
 
-	return token, userInfo, nil
+func generateSessionID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.URLEncoding.EncodeToString(b)
 }
 
 func SessionUsername(userInfo map[string]interface{}) string {
@@ -179,8 +386,9 @@ func SessionUsername(userInfo map[string]interface{}) string {
 	return ""
 }
 
-func DestroySession(c *gin.Context) error {
-	session := sessions.Default(c)
-	session.Clear()
-	return session.Save()
+func SessionUserID(userInfo map[string]interface{}) string {
+	if id, ok := userInfo["id"].(string); ok {
+		return id
+	}
+	return ""
 }
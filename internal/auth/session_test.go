@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+func getSession(sm *SessionManager, sessionID string) error {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sessionID})
+	_, _, err := sm.GetSession(c)
+	return err
+}
+
+// fakeClock 只在 Advance 时前进，过期测试不依赖真实时间
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newClockedSessionManager returns an in-memory session manager whose
+// manager and store both read the returned clock.
+func newClockedSessionManager(t *testing.T, options SessionOptions) (*SessionManager, *fakeClock) {
+	t.Helper()
+	sm := NewMemorySessionManager(options)
+	t.Cleanup(func() { sm.Close() })
+	clock := &fakeClock{now: time.Now()}
+	sm.now = clock.Now
+	sm.store.(*memoryStore).now = clock.Now
+	return sm, clock
+}
+
+func TestSessionIdleTimeoutSlides(t *testing.T) {
+	sm, clock := newClockedSessionManager(t, SessionOptions{
+		IdleTimeout:   30 * time.Minute,
+		MaxLifetime:   24 * time.Hour,
+		TouchInterval: time.Minute,
+	})
+
+	sessionID, err := sm.CreateSession(context.Background(), &oauth2.Token{AccessToken: "a"}, map[string]interface{}{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每次访问都在空闲超时之前，会话应一直有效
+	for i := 0; i < 4; i++ {
+		clock.Advance(20 * time.Minute)
+		if err := getSession(sm, sessionID); err != nil {
+			t.Fatalf("access %d: %v", i, err)
+		}
+	}
+
+	clock.Advance(31 * time.Minute)
+	if err := getSession(sm, sessionID); !errors.Is(err, ErrSessionNotFound) && !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("idle session err = %v, want expired", err)
+	}
+}
+
+func TestSessionMaxLifetime(t *testing.T) {
+	sm, clock := newClockedSessionManager(t, SessionOptions{
+		IdleTimeout:   time.Hour,
+		MaxLifetime:   2 * time.Hour,
+		TouchInterval: time.Minute,
+	})
+
+	sessionID, err := sm.CreateSession(context.Background(), &oauth2.Token{AccessToken: "a"}, map[string]interface{}{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 持续访问也不能超过绝对最长存活时间
+	for i := 0; i < 2; i++ {
+		clock.Advance(50 * time.Minute)
+		if err := getSession(sm, sessionID); err != nil {
+			t.Fatalf("access %d: %v", i, err)
+		}
+	}
+	clock.Advance(30 * time.Minute)
+	if err := getSession(sm, sessionID); err == nil {
+		t.Fatal("session outlived its max lifetime")
+	}
+}
+
+func TestSessionOptionsCleanupInterval(t *testing.T) {
+	tests := []struct {
+		options SessionOptions
+		want    time.Duration
+	}{
+		{SessionOptions{}, time.Minute},
+		{SessionOptions{IdleTimeout: 20 * time.Second}, 20 * time.Second},
+		{SessionOptions{IdleTimeout: 20 * time.Second, CleanupInterval: 5 * time.Second}, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.options.withDefaults().CleanupInterval; got != tt.want {
+			t.Errorf("CleanupInterval for %+v = %v, want %v", tt.options, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryStoreJanitor(t *testing.T) {
+	// janitor 的间隔足够长，由测试直接触发清理
+	s := newMemoryStore(time.Hour)
+	defer s.Close()
+	clock := &fakeClock{now: time.Now()}
+	s.now = clock.Now
+
+	ctx := context.Background()
+	s.Set(ctx, "short", []byte("1"), 5*time.Minute)
+	s.Set(ctx, "forever", []byte("2"), 0)
+	clock.Advance(10 * time.Minute)
+	s.deleteExpired()
+
+	s.mu.Lock()
+	_, shortLeft := s.entries["short"]
+	_, foreverLeft := s.entries["forever"]
+	s.mu.Unlock()
+	if shortLeft {
+		t.Error("expired entry was not removed by the janitor")
+	}
+	if !foreverLeft {
+		t.Error("entry without expiration was removed")
+	}
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrKeyNotFound is returned by SessionManager.Get when the key does not
+// exist or has expired.
+var ErrKeyNotFound = errors.New("key not found")
+
+// store 是 SessionManager 的底层键值存储
+type store interface {
+	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	// SetXX 仅在键已存在时写入
+	SetXX(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	// SetNX 仅在键不存在时写入，返回是否写入成功
+	SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// Replace 在同一事务中删除 oldKey 并写入 newKey
+	Replace(ctx context.Context, oldKey, newKey string, value []byte, expiration time.Duration) error
+	// 集合操作，成员以明文保存，只应用于不敏感的标识符
+	AddMember(ctx context.Context, key, member string) error
+	RemoveMember(ctx context.Context, key, member string) error
+	Members(ctx context.Context, key string) ([]string, error)
+	// CountKeys 统计以 prefix 开头的未过期键
+	CountKeys(ctx context.Context, prefix string) (int, error)
+	// Ping 检查存储是否可用
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type redisStore struct {
+	client *redis.Client
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	return s.client.Set(ctx, key, value, expiration).Err()
+}
+
+func (s *redisStore) SetXX(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	return s.client.SetXX(ctx, key, value, expiration).Err()
+}
+
+func (s *redisStore) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (s *redisStore) CountKeys(ctx context.Context, prefix string) (int, error) {
+	// SCAN 不会像 KEYS 那样长时间阻塞 Redis
+	count := 0
+	iter := s.client.Scan(ctx, 0, prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	return count, iter.Err()
+}
+
+func (s *redisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
+
+func (s *redisStore) Replace(ctx context.Context, oldKey, newKey string, value []byte, expiration time.Duration) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if oldKey != "" {
+			pipe.Del(ctx, oldKey)
+		}
+		pipe.Set(ctx, newKey, value, expiration)
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) AddMember(ctx context.Context, key, member string) error {
+	return s.client.SAdd(ctx, key, member).Err()
+}
+
+func (s *redisStore) RemoveMember(ctx context.Context, key, member string) error {
+	return s.client.SRem(ctx, key, member).Err()
+}
+
+func (s *redisStore) Members(ctx context.Context, key string) ([]string, error) {
+	return s.client.SMembers(ctx, key).Result()
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/majiayu000/gin-starter/internal/types"
+)
+
+var (
+	ErrInvalidAccessToken  = errors.New("invalid access token")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused 表示一个已轮换的 refresh token 被再次使用，整个 token 族已被吊销
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// TokenOptions configures a TokenService.
+type TokenOptions struct {
+	Issuer     string
+	Audience   string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// RefreshMaxLifetime 是 token 族从登录起的最长存活时间，轮换不会顺延
+	RefreshMaxLifetime time.Duration
+	// SigningKeys 是按 key ID 索引的 ES256 私钥，所有公钥都会发布在 JWKS 中
+	SigningKeys map[string]*ecdsa.PrivateKey
+	ActiveKeyID string
+}
+
+// TokenPair is the response body of the token endpoint.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type accessClaims struct {
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	jwt.StandardClaims
+}
+
+// refreshRecord 是 refresh token 在存储中的内容，键为 token 的哈希
+type refreshRecord struct {
+	FamilyID string `json:"family_id"`
+	// FamilyCreatedAt 是 token 族首次签发的时间
+	FamilyCreatedAt time.Time              `json:"family_created_at"`
+	UserInfo        map[string]interface{} `json:"user_info"`
+}
+
+// TokenService issues short-lived JWT access tokens and rotating refresh
+// tokens for API clients that can't use cookie sessions.
+//
+// Each refresh token can be used once. Refreshing returns a new token from
+// the same family; presenting an already used token revokes the whole family,
+// since it means the token was copied. A family can't be refreshed past
+// RefreshMaxLifetime after it was issued, so the user has to log in again.
+type TokenService struct {
+	sm      types.SessionManager
+	options TokenOptions
+	// now 是当前时间，测试中可替换为假时钟
+	now func() time.Time
+}
+
+// NewTokenService creates a TokenService that keeps refresh tokens in sm.
+func NewTokenService(sm types.SessionManager, options TokenOptions) (*TokenService, error) {
+	if _, ok := options.SigningKeys[options.ActiveKeyID]; !ok {
+		return nil, fmt.Errorf("active signing key %q not found", options.ActiveKeyID)
+	}
+	if options.AccessTTL <= 0 {
+		options.AccessTTL = 15 * time.Minute
+	}
+	if options.RefreshTTL <= 0 {
+		options.RefreshTTL = 30 * 24 * time.Hour
+	}
+	if options.RefreshMaxLifetime <= 0 {
+		options.RefreshMaxLifetime = 90 * 24 * time.Hour
+	}
+	return &TokenService{sm: sm, options: options, now: time.Now}, nil
+}
+
+// IssueTokens starts a new refresh token family for the user.
+func (s *TokenService) IssueTokens(ctx context.Context, userInfo map[string]interface{}) (*TokenPair, error) {
+	return s.issue(ctx, generateSessionID(), s.now(), userInfo)
+}
+
+func (s *TokenService) issue(ctx context.Context, familyID string, familyCreatedAt time.Time, userInfo map[string]interface{}) (*TokenPair, error) {
+	accessToken, err := s.signAccessToken(userInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	// refresh token 不能活得比所属的 token 族更久
+	ttl := min(s.options.RefreshTTL, familyCreatedAt.Add(s.options.RefreshMaxLifetime).Sub(s.now()))
+	refreshToken := generateSessionID()
+	record := refreshRecord{FamilyID: familyID, FamilyCreatedAt: familyCreatedAt, UserInfo: userInfo}
+	if err := s.sm.Set(ctx, refreshKey(refreshToken), record, ttl); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.options.AccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented
+// token is consumed. Tokens of a family older than RefreshMaxLifetime are
+// rejected with ErrInvalidRefreshToken.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	key := refreshKey(refreshToken)
+
+	var record refreshRecord
+	if err := s.sm.Get(ctx, key, &record); err != nil {
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrTamperedValue) || errors.Is(err, ErrUnknownKey) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	// 早于此项修改签发的记录没有族创建时间，从本次刷新开始计算
+	if record.FamilyCreatedAt.IsZero() {
+		record.FamilyCreatedAt = s.now()
+	}
+	if s.now().Sub(record.FamilyCreatedAt) >= s.options.RefreshMaxLifetime {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var revoked bool
+	err := s.sm.Get(ctx, familyRevokedKey(record.FamilyID), &revoked)
+	if err == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+
+	// 原子地标记 token 已使用，并发的第二次使用会被识别为重用
+	claimed, err := s.sm.SetNX(ctx, refreshUsedKey(refreshToken), true, s.options.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		if err := s.revokeFamily(ctx, record.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return s.issue(ctx, record.FamilyID, record.FamilyCreatedAt, record.UserInfo)
+}
+
+// Revoke revokes the family of the given refresh token. Unknown tokens are
+// ignored.
+func (s *TokenService) Revoke(ctx context.Context, refreshToken string) error {
+	var record refreshRecord
+	if err := s.sm.Get(ctx, refreshKey(refreshToken), &record); err != nil {
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrTamperedValue) || errors.Is(err, ErrUnknownKey) {
+			return nil
+		}
+		return err
+	}
+	return s.revokeFamily(ctx, record.FamilyID)
+}
+
+func (s *TokenService) revokeFamily(ctx context.Context, familyID string) error {
+	return s.sm.Set(ctx, familyRevokedKey(familyID), true, s.options.RefreshTTL)
+}
+
+func (s *TokenService) signAccessToken(userInfo map[string]interface{}) (string, error) {
+	now := s.now()
+	claims := accessClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.options.Issuer,
+			Audience:  s.options.Audience,
+			Subject:   stringClaim(userInfo, "id"),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(s.options.AccessTTL).Unix(),
+		},
+		Name:          stringClaim(userInfo, "name"),
+		Email:         stringClaim(userInfo, "email"),
+		EmailVerified: boolClaim(userInfo, "email_verified"),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = s.options.ActiveKeyID
+	return token.SignedString(s.options.SigningKeys[s.options.ActiveKeyID])
+}
+
+// VerifyAccessToken validates an access token and returns the user info it
+// was issued for, in the same shape as a session's user info.
+func (s *TokenService) VerifyAccessToken(raw string) (map[string]interface{}, error) {
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodES256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		keyID, _ := token.Header["kid"].(string)
+		key, ok := s.options.SigningKeys[keyID]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", keyID)
+		}
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+	if claims.ExpiresAt == 0 || claims.Subject == "" ||
+		!claims.VerifyIssuer(s.options.Issuer, true) ||
+		!claims.VerifyAudience(s.options.Audience, true) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	return map[string]interface{}{
+		"id":             claims.Subject,
+		"name":           claims.Name,
+		"email":          claims.Email,
+		"email_verified": claims.EmailVerified,
+	}, nil
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JWKS returns the public halves of all signing keys, for publishing at
+// /.well-known/jwks.json.
+func (s *TokenService) JWKS() []JWK {
+	keyIDs := make([]string, 0, len(s.options.SigningKeys))
+	for keyID := range s.options.SigningKeys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	keys := make([]JWK, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		pub := s.options.SigningKeys[keyID].PublicKey
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		keys = append(keys, JWK{
+			KeyType:   "EC",
+			Curve:     pub.Curve.Params().Name,
+			X:         base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:         base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+			KeyID:     keyID,
+			Use:       "sig",
+			Algorithm: "ES256",
+		})
+	}
+	return keys
+}
+
+// LoadSigningKey reads a PKCS#8 PEM encoded P-256 private key.
+func LoadSigningKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecdsaKey.Curve != elliptic.P256() {
+		return nil, errors.New("signing key is not a P-256 ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+// GenerateSigningKey creates a random P-256 key. Tokens signed with it can't
+// be verified after a restart or by other instances.
+func GenerateSigningKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func stringClaim(userInfo map[string]interface{}, key string) string {
+	value, _ := userInfo[key].(string)
+	return value
+}
+
+func boolClaim(userInfo map[string]interface{}, key string) bool {
+	value, _ := userInfo[key].(bool)
+	return value
+}
+
+func refreshKey(token string) string {
+	return "refresh_token:" + hashToken(token)
+}
+
+func refreshUsedKey(token string) string {
+	return "refresh_token_used:" + hashToken(token)
+}
+
+func familyRevokedKey(familyID string) string {
+	return "refresh_family_revoked:" + familyID
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
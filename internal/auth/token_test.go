@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestTokenService(t *testing.T) *TokenService {
+	t.Helper()
+	sm := NewMemorySessionManager(SessionOptions{})
+	t.Cleanup(func() { sm.Close() })
+
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := NewTokenService(sm, TokenOptions{
+		Issuer:      "test",
+		Audience:    "test-api",
+		SigningKeys: map[string]*ecdsa.PrivateKey{"k1": key},
+		ActiveKeyID: "k1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	ts := newTestTokenService(t)
+
+	tokens, err := ts.IssueTokens(context.Background(), map[string]interface{}{"id": "42", "name": "Jane", "email": "jane@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userInfo, err := ts.VerifyAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userInfo["id"] != "42" || userInfo["email"] != "jane@example.com" || userInfo["email_verified"] != true {
+		t.Fatalf("userInfo = %v", userInfo)
+	}
+
+	other := newTestTokenService(t)
+	if _, err := other.VerifyAccessToken(tokens.AccessToken); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Fatalf("token signed by another key: err = %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	ts := newTestTokenService(t)
+	ctx := context.Background()
+
+	first, err := ts.IssueTokens(ctx, map[string]interface{}{"id": "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ts.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重放已使用的 token 会吊销整个 token 族
+	if _, err := ts.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := ts.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("token from revoked family: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshTokenFamilyMaxLifetime(t *testing.T) {
+	sm, clock := newClockedSessionManager(t, SessionOptions{})
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := NewTokenService(sm, TokenOptions{
+		Issuer:             "test",
+		Audience:           "test-api",
+		RefreshTTL:         30 * 24 * time.Hour,
+		RefreshMaxLifetime: 45 * 24 * time.Hour,
+		SigningKeys:        map[string]*ecdsa.PrivateKey{"k1": key},
+		ActiveKeyID:        "k1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.now = clock.Now
+	ctx := context.Background()
+
+	tokens, err := ts.IssueTokens(ctx, map[string]interface{}{"id": "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每次轮换都在 refresh TTL 之内，但 token 族不能超过最长存活时间
+	for i := 0; i < 2; i++ {
+		clock.Advance(20 * 24 * time.Hour)
+		if tokens, err = ts.Refresh(ctx, tokens.RefreshToken); err != nil {
+			t.Fatalf("refresh %d: %v", i, err)
+		}
+	}
+	clock.Advance(6 * 24 * time.Hour)
+	if _, err := ts.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("refresh past max lifetime: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestJWKSPublishesSigningKeys(t *testing.T) {
+	ts := newTestTokenService(t)
+
+	keys := ts.JWKS()
+	if len(keys) != 1 || keys[0].KeyID != "k1" || keys[0].Curve != "P-256" || len(keys[0].X) != 43 {
+		t.Fatalf("JWKS = %+v", keys)
+	}
+}
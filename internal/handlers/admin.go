@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/middleware"
+)
+
+// AdminHandler serves the operator endpoints under /admin.
+type AdminHandler struct {
+	oauthManager *auth.OAuthManager
+}
+
+func NewAdminHandler(om *auth.OAuthManager) *AdminHandler {
+	return &AdminHandler{oauthManager: om}
+}
+
+// ListProviders returns every registered OAuth provider and whether it is
+// enabled, in configured order.
+func (h *AdminHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.oauthManager.Providers()})
+}
+
+// EnableProvider allows logins through a provider again.
+func (h *AdminHandler) EnableProvider(c *gin.Context) {
+	h.setProviderEnabled(c, true)
+}
+
+// DisableProvider rejects new logins through a provider until it is enabled
+// again. With a shared store every instance applies the change within the
+// sync interval and it survives restarts. Existing sessions are not
+// affected.
+func (h *AdminHandler) DisableProvider(c *gin.Context) {
+	h.setProviderEnabled(c, false)
+}
+
+func (h *AdminHandler) setProviderEnabled(c *gin.Context, enabled bool) {
+	provider := c.Param("provider")
+	if err := h.oauthManager.SetEnabled(c.Request.Context(), provider, enabled); err != nil {
+		if errors.Is(err, auth.ErrUnknownProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Provider not found"})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("failed to update provider", "provider", provider, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update provider"})
+		return
+	}
+
+	// 记录操作人，便于审计
+	userInfo, _ := middleware.CurrentUser(c)
+	logger.FromContext(c.Request.Context()).Info("OAuth provider updated",
+		"provider", provider, "enabled", enabled, "admin", auth.SessionUserID(userInfo))
+	c.JSON(http.StatusOK, auth.ProviderStatus{Name: provider, Enabled: enabled})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/middleware"
+	"github.com/majiayu000/gin-starter/internal/types"
+	"golang.org/x/oauth2"
+)
+
+func newAdminTestRouter(t *testing.T) (*gin.Engine, types.SessionManager) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	sm := auth.NewMemorySessionManager(auth.SessionOptions{})
+	t.Cleanup(func() { sm.Close() })
+	om := auth.NewOAuthManager()
+	om.AddProvider("fake", fakeProvider{})
+	om.AddProvider("other", fakeProvider{})
+	h := NewAuthHandler(om, sm, nil)
+	admin := NewAdminHandler(om)
+
+	r := gin.New()
+	r.Use(middleware.Authenticate(sm, nil, nil))
+	r.Use(middleware.CSRF([]byte("test-csrf-key")))
+	r.GET("/auth/:provider/login", h.HandleGoogleLogin)
+	r.GET("/auth/csrf", h.CSRFToken)
+	g := r.Group("/admin", middleware.RequireAuth(), middleware.RequireAdmin([]string{"Admin@example.com"}))
+	g.GET("/providers", admin.ListProviders)
+	g.POST("/providers/:provider/enable", admin.EnableProvider)
+	g.POST("/providers/:provider/disable", admin.DisableProvider)
+	return r, sm
+}
+
+func TestAdminDisableProvider(t *testing.T) {
+	r, sm := newAdminTestRouter(t)
+	ctx := context.Background()
+	adminID, err := sm.CreateSession(ctx, &oauth2.Token{AccessToken: "a"}, map[string]interface{}{"id": "1", "email": "admin@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 邮箱未经 provider 验证时不能获得管理员权限
+	unverifiedID, err := sm.CreateSession(ctx, &oauth2.Token{AccessToken: "c"}, map[string]interface{}{"id": "3", "email": "admin@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := sm.CreateSession(ctx, &oauth2.Token{AccessToken: "b"}, map[string]interface{}{"id": "2", "email": "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/providers/fake/disable", nil)
+	if w := serve(r, withSession(t, r, req, userID)); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/admin/providers/fake/disable", nil)
+	if w := serve(r, withSession(t, r, req, unverifiedID)); w.Code != http.StatusForbidden {
+		t.Fatalf("unverified admin email status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/providers/fake/disable", nil)
+	if w := serve(r, withSession(t, r, req, adminID)); w.Code != http.StatusOK {
+		t.Fatalf("disable status = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/login", nil)); w.Code != http.StatusBadRequest {
+		t.Fatalf("login through disabled provider status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/providers", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: adminID})
+	w := serve(r, req)
+	var body struct {
+		Providers []auth.ProviderStatus `json:"providers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []auth.ProviderStatus{{Name: "fake", Enabled: false}, {Name: "other", Enabled: true}}
+	if len(body.Providers) != 2 || body.Providers[0] != want[0] || body.Providers[1] != want[1] {
+		t.Fatalf("providers = %+v, want %+v", body.Providers, want)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/providers/fake/enable", nil)
+	if w := serve(r, withSession(t, r, req, adminID)); w.Code != http.StatusOK {
+		t.Fatalf("enable status = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/login", nil)); w.Code != http.StatusFound {
+		t.Fatalf("login after enable status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/providers/missing/disable", nil)
+	if w := serve(r, withSession(t, r, req, adminID)); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown provider status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
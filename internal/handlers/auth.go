@@ -1,35 +1,48 @@
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/metrics"
+	"github.com/majiayu000/gin-starter/internal/middleware"
 	"github.com/majiayu000/gin-starter/internal/types"
 )
 
 type AuthHandler struct {
 	oauthManager   *auth.OAuthManager
 	sessionManager types.SessionManager
+	tokenService   *auth.TokenService
 }
 
-func NewAuthHandler(om *auth.OAuthManager, sm types.SessionManager) *AuthHandler {
+// loginState 是 OAuth state 在存储中的内容
+type loginState struct {
+	// ResponseType 为 "token" 时回调返回 JWT 而不是设置 session cookie
+	ResponseType string `json:"response_type,omitempty"`
+}
+
+// NewAuthHandler creates an AuthHandler. ts may be nil, in which case logins
+// can only create cookie sessions.
+func NewAuthHandler(om *auth.OAuthManager, sm types.SessionManager, ts *auth.TokenService) *AuthHandler {
 	return &AuthHandler{
 		oauthManager:   om,
 		sessionManager: sm,
+		tokenService:   ts,
 	}
 }
 
 // HandleProfile handles the user profile request
 func (h *AuthHandler) HandleProfile(c *gin.Context) {
-	_, userInfo, err := h.sessionManager.GetSession(c)
-	fmt.Print("user info is ", userInfo)
-	if err != nil {
+	userInfo, ok := middleware.CurrentUser(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
@@ -59,15 +72,22 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// API 客户端通过 response_type=token 在回调中直接获取 JWT
+	loginState := loginState{ResponseType: c.Query("response_type")}
+	if loginState.ResponseType != "" && (loginState.ResponseType != "token" || h.tokenService == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported response type"})
+		return
+	}
+
 	// 生成状态并存储在 Redis 中
 	state := generateRandomState()
-	err = h.sessionManager.Set(c.Request.Context(), "oauth_state:"+state, true, 10*time.Minute)
+	err = h.sessionManager.Set(c.Request.Context(), "oauth_state:"+state, loginState, 10*time.Minute)
 	if err != nil {
-		log.Printf("Error setting state in Redis: %v", err)
+		logger.FromContext(c.Request.Context()).Error("failed to store OAuth state", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize login"})
 		return
 	}
-	log.Printf("Generated and stored state: %s", state)
+	logger.FromContext(c.Request.Context()).Debug("generated OAuth state", "provider", provider, "state", state)
 
 	authURL := providerInstance.GetAuthURL(state)
 	c.Redirect(http.StatusFound, authURL)
@@ -77,13 +97,21 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 	provider := c.Param("provider")
 	code := c.Query("code")
 	state := c.Query("state")
-	log.Printf("Received state in callback: %s", state)
+	log := logger.FromContext(c.Request.Context()).With("provider", provider)
+	log.Debug("received OAuth callback", "state", state)
+
+	// 未知的 provider 统一计入 "unknown"，避免任意路径参数产生新的指标序列
+	metricProvider := provider
+	if _, err := h.oauthManager.GetProvider(provider); err != nil {
+		metricProvider = "unknown"
+	}
 
 	// 验证状态
-	var stateExists bool
-	err := h.sessionManager.Get(c.Request.Context(), "oauth_state:"+state, &stateExists)
-	if err != nil || !stateExists {
-		log.Printf("Invalid state: %v", err)
+	var loginState loginState
+	err := h.sessionManager.Get(c.Request.Context(), "oauth_state:"+state, &loginState)
+	if err != nil {
+		log.Warn("invalid OAuth state", "error", err)
+		metrics.ObserveLogin(metricProvider, metrics.LoginInvalidState)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
 		return
 	}
@@ -91,61 +119,59 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 	// 删除已使用的状态
 	h.sessionManager.Delete(c.Request.Context(), "oauth_state:"+state)
 
-	log.Printf("Received authorization code: %s", code)
-
-	token, err := h.oauthManager.Exchange(provider, code)
+	token, err := h.oauthManager.Exchange(c.Request.Context(), provider, code)
 	if err != nil {
-		log.Printf("Exchange error: %v", err)
+		log.Error("failed to exchange authorization code", "error", err)
+		metrics.ObserveLogin(metricProvider, metrics.LoginExchangeError)
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Provider timed out"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to exchange token: %v", err)})
 		return
 	}
 
-	userInfo, err := h.oauthManager.GetUserInfo(provider, token)
-	log.Printf("UserInfo: %+v", userInfo)
+	userInfo, err := h.oauthManager.GetUserInfo(c.Request.Context(), provider, token)
 	if err != nil {
-		log.Printf("User info error: %v", err)
+		log.Error("failed to get user info", "error", err)
+		metrics.ObserveLogin(metricProvider, metrics.LoginUserInfoError)
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Provider timed out"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
 		return
 	}
 
-	// 创建会话并存储在 Redis 中
-	sessionID := generateSessionID()
-	sessionData := map[string]interface{}{
-		"token":     token,
-		"user_info": userInfo,
-	}
-	err = h.sessionManager.Set(c.Request.Context(), "session:"+sessionID, sessionData, 24*time.Hour)
-	if err != nil {
-		log.Printf("Session creation error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+	if loginState.ResponseType == "token" {
+		tokens, err := h.tokenService.IssueTokens(c.Request.Context(), userInfo)
+		if err != nil {
+			log.Error("failed to issue tokens", "error", err)
+			metrics.ObserveLogin(metricProvider, metrics.LoginIssueError)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue tokens"})
+			return
+		}
+		metrics.ObserveLogin(metricProvider, metrics.LoginSuccess)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, tokens)
 		return
 	}
 
-	// 设置 session cookie
-	c.SetCookie(
-		"session_id",
-		sessionID,
-		int(24*time.Hour.Seconds()), // 1 day in seconds
-		"/",
-		"",
-		false,
-		true,
-	)
-
-	log.Printf("Session created successfully. Session ID: %s", sessionID)
-
-	// 设置 cookie
-
-	// 验证会话是否正确保存
-	var checkSessionInfo map[string]interface{}
-	err = h.sessionManager.Get(c.Request.Context(), "session:"+sessionID, &checkSessionInfo)
+	// 创建新会话，同时作废登录前的会话，防止会话固定攻击
+	oldSessionID, _ := c.Cookie(auth.SessionCookieName)
+	sessionID, err := h.sessionManager.RotateSession(c.Request.Context(), oldSessionID, token, userInfo)
 	if err != nil {
-		log.Println("Warning: Session info not found before redirect")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Session validation failed"})
+		log.Error("failed to create session", "error", err)
+		metrics.ObserveLogin(metricProvider, metrics.LoginIssueError)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 		return
 	}
 
-	log.Printf("Session verified successfully before redirect. Session ID: %s", sessionID)
+	// 设置 session cookie，服务端会话的空闲和绝对过期由 SessionManager 控制
+	h.sessionManager.SetCookie(c, sessionID)
+
+	log.Info("user logged in", "user_id", auth.SessionUserID(userInfo))
+	metrics.ObserveLogin(metricProvider, metrics.LoginSuccess)
 
 	c.Redirect(http.StatusFound, "/")
 }
@@ -156,23 +182,33 @@ func generateRandomState() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
-func generateSessionID() string {
-	b := make([]byte, 32)
-	rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if sessionID, err := c.Cookie(auth.SessionCookieName); err == nil {
+		if err := h.sessionManager.DeleteSession(c.Request.Context(), sessionID); err != nil {
+			logger.FromContext(c.Request.Context()).Error("failed to delete session", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to destroy session"})
+			return
+		}
+		h.sessionManager.ClearCookie(c)
+	}
+	c.Redirect(http.StatusFound, "/")
 }
 
-func (h *AuthHandler) Logout(c *gin.Context) {
-	if err := auth.DestroySession(c); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to destroy session"})
+// CSRFToken returns the token cookie-authenticated clients must send in the
+// X-CSRF-Token header with state-changing requests.
+func (h *AuthHandler) CSRFToken(c *gin.Context) {
+	token := middleware.CSRFToken(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
-	c.Redirect(http.StatusFound, "/")
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"csrf_token": token})
 }
+
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
-	_, userInfo, err := h.sessionManager.GetSession(c)
-	fmt.Println("get session", userInfo)
-	if err != nil {
+	userInfo, ok := middleware.CurrentUser(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/auth/oauth"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/middleware"
+	"github.com/majiayu000/gin-starter/internal/types"
+	"golang.org/x/oauth2"
+)
+
+// fakeProvider 是不访问网络的 oauth.Provider
+type fakeProvider struct{}
+
+func (fakeProvider) GetAuthURL(state string) string {
+	return "https://provider.example/auth?state=" + url.QueryEscape(state)
+}
+
+func (fakeProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	if code == "slow" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &oauth2.Token{AccessToken: "access-" + code, TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func (fakeProvider) GetLoginHandler() gin.HandlerFunc { return nil }
+
+func (fakeProvider) GetCallbackHandler(successHandler http.Handler) gin.HandlerFunc { return nil }
+
+func (fakeProvider) GetUserInfo(ctx context.Context, token *oauth2.Token) (*oauth.UserInfo, error) {
+	return &oauth.UserInfo{ID: "42", Name: "Jane", Email: "jane@example.com"}, nil
+}
+
+func newTestRouter(t *testing.T) (*gin.Engine, types.SessionManager) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	sm := auth.NewMemorySessionManager(auth.SessionOptions{})
+	t.Cleanup(func() { sm.Close() })
+
+	key, err := auth.GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := auth.NewTokenService(sm, auth.TokenOptions{
+		Issuer:      "test",
+		Audience:    "test-api",
+		SigningKeys: map[string]*ecdsa.PrivateKey{"k1": key},
+		ActiveKeyID: "k1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	om := auth.NewOAuthManager()
+	om.AddProvider("fake", fakeProvider{})
+	h := NewAuthHandler(om, sm, ts)
+
+	r := gin.New()
+	pats := NewPATHandler(auth.NewPATService(sm, auth.PATOptions{}))
+	r.Use(middleware.Authenticate(sm, ts, pats.patService))
+	r.Use(middleware.CSRF([]byte("test-csrf-key")))
+	r.GET("/", middleware.RequireAuth(), middleware.RequireScope(auth.ScopeProfileRead), h.HandleProfile)
+	r.GET("/auth/:provider/login", h.HandleGoogleLogin)
+	r.GET("/auth/:provider/callback", h.HandleGoogleCallback)
+	r.POST("/logout", h.HandleLogout)
+	r.GET("/auth/csrf", h.CSRFToken)
+
+	me := r.Group("/api/me", middleware.RequireAuth(), middleware.RequireAuthMethod(middleware.AuthMethodSession, middleware.AuthMethodBearer))
+	me.GET("/tokens", pats.List)
+	me.POST("/tokens", pats.Create)
+	me.DELETE("/tokens/:id", pats.Revoke)
+	return r, sm
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// withSession 为请求附加会话 cookie 和对应的 CSRF token
+func withSession(t *testing.T, r *gin.Engine, req *http.Request, sessionID string) *http.Request {
+	t.Helper()
+	cookie := &http.Cookie{Name: auth.SessionCookieName, Value: sessionID}
+
+	csrfReq := httptest.NewRequest(http.MethodGet, "/auth/csrf", nil)
+	csrfReq.AddCookie(cookie)
+	w := serve(r, csrfReq)
+	var body struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.CSRFToken == "" {
+		t.Fatalf("failed to get CSRF token: %d %s", w.Code, w.Body)
+	}
+
+	req.AddCookie(cookie)
+	req.Header.Set(middleware.CSRFHeader, body.CSRFToken)
+	return req
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == auth.SessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatalf("no %s cookie in response", auth.SessionCookieName)
+	return nil
+}
+
+func TestLoginStoresState(t *testing.T) {
+	r, sm := newTestRouter(t)
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := location.Query().Get("state")
+
+	var stored loginState
+	if err := sm.Get(context.Background(), "oauth_state:"+state, &stored); err != nil {
+		t.Fatalf("state %q not stored: %v", state, err)
+	}
+}
+
+func TestLoginUnknownProvider(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/unknown/login", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCallbackRejectsUnknownState(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/callback?code=abc&state=forged", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCallbackCreatesSession(t *testing.T) {
+	r, sm := newTestRouter(t)
+	if err := sm.Set(context.Background(), "oauth_state:s1", loginState{}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/callback?code=abc&state=s1", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusFound, w.Body)
+	}
+	cookie := sessionCookie(t, w)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	w = serve(r, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("profile status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// state 只能使用一次
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/callback?code=abc&state=s1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed state status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCallbackRotatesExistingSession(t *testing.T) {
+	r, sm := newTestRouter(t)
+	ctx := context.Background()
+
+	oldID, err := sm.CreateSession(ctx, &oauth2.Token{AccessToken: "old"}, map[string]interface{}{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Set(ctx, "oauth_state:s1", loginState{}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?code=abc&state=s1", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: oldID})
+	w := serve(r, req)
+	if cookie := sessionCookie(t, w); cookie.Value == oldID {
+		t.Fatal("session ID was not rotated on login")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: oldID})
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("old session status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCallbackIssuesTokens(t *testing.T) {
+	r, sm := newTestRouter(t)
+	if err := sm.Set(context.Background(), "oauth_state:s1", loginState{ResponseType: "token"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/callback?code=abc&state=s1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var tokens auth.TokenPair
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("incomplete token pair: %+v", tokens)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w = serve(r, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bearer profile status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken+"x")
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("forged bearer status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestProfileRequiresSession(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestLogoutDeletesSession(t *testing.T) {
+	r, sm := newTestRouter(t)
+
+	sessionID, err := sm.CreateSession(context.Background(), &oauth2.Token{AccessToken: "a"}, map[string]interface{}{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := &http.Cookie{Name: auth.SessionCookieName, Value: sessionID}
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	if w := serve(r, withSession(t, r, req, sessionID)); w.Code != http.StatusFound {
+		t.Fatalf("logout status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("profile after logout status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestLogoutRequiresCSRFToken(t *testing.T) {
+	r, sm := newTestRouter(t)
+
+	sessionID, err := sm.CreateSession(context.Background(), &oauth2.Token{AccessToken: "a"}, map[string]interface{}{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := &http.Cookie{Name: auth.SessionCookieName, Value: sessionID}
+
+	// 非 bearer 的 Authorization 头不能绕过 CSRF 校验
+	for name, header := range map[string]http.Header{
+		"missing":       {},
+		"forged":        {middleware.CSRFHeader: {"forged"}},
+		"basic auth":    {"Authorization": {"Basic eDp4"}},
+		"invalid token": {"Authorization": {"Bearer"}},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+		req.AddCookie(cookie)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if w := serve(r, req); w.Code != http.StatusForbidden {
+			t.Fatalf("%s token: status = %d, want %d", name, w.Code, http.StatusForbidden)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if w := serve(r, req); w.Code != http.StatusOK {
+		t.Fatalf("session was destroyed by a forged request: status = %d", w.Code)
+	}
+}
+
+func TestSessionCookieAttributes(t *testing.T) {
+	sm := auth.NewMemorySessionManager(auth.SessionOptions{
+		Cookie: auth.CookieOptions{Domain: "example.com", Secure: true, SameSite: http.SameSiteStrictMode},
+	})
+	defer sm.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	sm.SetCookie(c, "id")
+
+	header := w.Header().Get("Set-Cookie")
+	for _, attr := range []string{"Domain=example.com", "Secure", "HttpOnly", "SameSite=Strict"} {
+		if !strings.Contains(header, attr) {
+			t.Errorf("Set-Cookie %q lacks %s", header, attr)
+		}
+	}
+}
+
+func TestLoginFlowDoesNotLogSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logger.New(&buf, slog.LevelDebug, "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	r, _ := newTestRouter(t)
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/login", nil))
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := location.Query().Get("state")
+
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/auth/fake/callback?code=secret-code&state="+url.QueryEscape(state), nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusFound, w.Body)
+	}
+	cookie := sessionCookie(t, w)
+
+	out := buf.String()
+	if out == "" {
+		t.Fatal("nothing was logged")
+	}
+	for _, secret := range []string{"secret-code", "access-secret-code", state, cookie.Value} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("log output leaks %q: %s", secret, out)
+		}
+	}
+}
+
+func TestCallbackHonorsRequestDeadline(t *testing.T) {
+	r, sm := newTestRouter(t)
+	if err := sm.Set(context.Background(), "oauth_state:s1", loginState{}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?code=slow&state=s1", nil).WithContext(ctx)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(r, req) }()
+	select {
+	case w := <-done:
+		if w.Code != http.StatusGatewayTimeout {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback ignored the request deadline")
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/middleware"
+)
+
+// PATHandler lets users manage their personal access tokens under
+// /api/me/tokens.
+type PATHandler struct {
+	patService *auth.PATService
+}
+
+func NewPATHandler(ps *auth.PATService) *PATHandler {
+	return &PATHandler{patService: ps}
+}
+
+type createPATRequest struct {
+	Name      string    `json:"name" binding:"required,max=100"`
+	Scopes    []string  `json:"scopes" binding:"required"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// createPATResponse 是创建 token 的响应，明文 token 只在此处返回一次
+type createPATResponse struct {
+	auth.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// List returns the current user's tokens without their secrets.
+func (h *PATHandler) List(c *gin.Context) {
+	userInfo, _ := middleware.CurrentUser(c)
+	tokens, err := h.patService.List(c.Request.Context(), auth.SessionUserID(userInfo))
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to list tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// Create issues a new token. The response is the only time the token is
+// shown.
+func (h *PATHandler) Create(c *gin.Context) {
+	var req createPATRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userInfo, _ := middleware.CurrentUser(c)
+	token, plain, err := h.patService.Create(c.Request.Context(), userInfo, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidScope) || errors.Is(err, auth.ErrInvalidExpiry) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("failed to create token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, createPATResponse{PersonalAccessToken: *token, Token: plain})
+}
+
+// Revoke deletes one of the current user's tokens.
+func (h *PATHandler) Revoke(c *gin.Context) {
+	userInfo, _ := middleware.CurrentUser(c)
+	err := h.patService.Revoke(c.Request.Context(), auth.SessionUserID(userInfo), c.Param("id"))
+	if errors.Is(err, auth.ErrPATNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to revoke token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
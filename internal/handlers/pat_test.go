@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"golang.org/x/oauth2"
+)
+
+func TestPersonalAccessTokenLifecycle(t *testing.T) {
+	r, sm := newTestRouter(t)
+
+	sessionID, err := sm.CreateSession(context.Background(), &oauth2.Token{AccessToken: "a"}, map[string]interface{}{"id": "42", "name": "Jane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withSession := func(req *http.Request) *http.Request {
+		return withSession(t, r, req, sessionID)
+	}
+
+	body := `{"name":"nightly export","scopes":["profile:read"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/me/tokens", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := serve(r, withSession(req))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	var created createPATResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Token, auth.PATPrefix) {
+		t.Fatalf("token = %q", created.Token)
+	}
+
+	// 列表中不包含明文 token
+	w = serve(r, withSession(httptest.NewRequest(http.MethodGet, "/api/me/tokens", nil)))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), created.Token) || !strings.Contains(w.Body.String(), created.ID) {
+		t.Fatalf("list status = %d, body = %s", w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	if w := serve(r, req); w.Code != http.StatusOK {
+		t.Fatalf("profile with token status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/me/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	if w := serve(r, req); w.Code != http.StatusForbidden {
+		t.Fatalf("token managing tokens status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = serve(r, withSession(httptest.NewRequest(http.MethodDelete, "/api/me/tokens/"+created.ID, nil)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Token)
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	r, sm := newTestRouter(t)
+	pats := auth.NewPATService(sm, auth.PATOptions{})
+
+	_, token, err := pats.Create(context.Background(), map[string]interface{}{"id": "42"}, "search only", []string{auth.ScopeSearchRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if w := serve(r, req); w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	if _, _, err := pats.Create(context.Background(), map[string]interface{}{"id": "42"}, "bad", []string{"admin"}, time.Time{}); err == nil {
+		t.Fatal("unknown scope accepted")
+	}
+}
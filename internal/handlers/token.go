@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/logger"
+)
+
+// TokenHandler serves the token endpoints used by API clients.
+type TokenHandler struct {
+	tokenService *auth.TokenService
+}
+
+func NewTokenHandler(ts *auth.TokenService) *TokenHandler {
+	return &TokenHandler{tokenService: ts}
+}
+
+// Token exchanges a refresh token for a new token pair
+// (grant_type=refresh_token). Error codes follow RFC 6749.
+func (h *TokenHandler) Token(c *gin.Context) {
+	if c.PostForm("grant_type") != "refresh_token" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+		return
+	}
+
+	tokens, err := h.tokenService.Refresh(c.Request.Context(), c.PostForm("refresh_token"))
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			logger.FromContext(c.Request.Context()).Warn("refresh token reuse detected, token family revoked")
+		}
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("failed to refresh token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Revoke revokes a refresh token and every token rotated from the same
+// login. As in RFC 7009, unknown tokens are not an error.
+func (h *TokenHandler) Revoke(c *gin.Context) {
+	if err := h.tokenService.Revoke(c.Request.Context(), c.PostForm("token")); err != nil {
+		logger.FromContext(c.Request.Context()).Error("failed to revoke refresh token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// JWKS publishes the public keys access tokens are signed with.
+func (h *TokenHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": h.tokenService.JWKS()})
+}
@@ -8,9 +8,17 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func GetUser(c *gin.Context) {
+type UserHandler struct {
+	userService *services.UserService
+}
+
+func NewUserHandler(us *services.UserService) *UserHandler {
+	return &UserHandler{userService: us}
+}
+
+func (h *UserHandler) GetUser(c *gin.Context) {
 	userID := c.Param("id")
-	user, err := services.GetUser(userID)
+	user, err := h.userService.GetUser(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -0,0 +1,141 @@
+// internal/health/health.go
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckFunc reports whether a dependency is available. It should return once
+// ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is the outcome of one dependency check.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Readiness tracks whether the instance should receive traffic. It is ready
+// when the server has marked it ready and every registered dependency check
+// passes. The server marks it not ready again when shutdown begins, so the
+// load balancer stops routing to it before connections are drained.
+type Readiness struct {
+	ready   atomic.Bool
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+// NewReadiness creates a Readiness whose checks each get at most timeout.
+func NewReadiness(timeout time.Duration) *Readiness {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Readiness{timeout: timeout}
+}
+
+// AddCheck registers a dependency that must be available for the instance
+// to be ready.
+func (r *Readiness) AddCheck(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check{name: name, fn: fn})
+}
+
+func (r *Readiness) SetReady(ready bool) {
+	r.ready.Store(ready)
+}
+
+func (r *Readiness) Ready() bool {
+	return r.ready.Load()
+}
+
+// Check runs every dependency check concurrently and reports whether all of
+// them passed.
+func (r *Readiness) Check(ctx context.Context) (bool, map[string]CheckResult) {
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c.fn)
+		}(i, c)
+	}
+	wg.Wait()
+
+	ok := true
+	byName := make(map[string]CheckResult, len(checks))
+	for i, c := range checks {
+		byName[c.name] = results[i]
+		if results[i].Status != "up" {
+			ok = false
+		}
+	}
+	return ok, byName
+}
+
+// runCheck 在检查函数不理会 ctx 时也会按时返回
+func runCheck(ctx context.Context, fn CheckFunc) CheckResult {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: "up", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = "down"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Handler serves the readiness probe: 200 when the instance is ready and all
+// dependencies are up, 503 otherwise. The body lists each dependency's
+// status and latency.
+func (r *Readiness) Handler(c *gin.Context) {
+	if !r.Ready() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready"})
+		return
+	}
+
+	ok, results := r.Check(c.Request.Context())
+	status, code := "ready", http.StatusOK
+	if !ok {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": results})
+}
+
+// Liveness serves the liveness probe. It only reports that the process is
+// serving requests and never checks dependencies, so a dependency outage
+// doesn't get healthy instances restarted.
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
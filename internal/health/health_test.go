@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	readiness := NewReadiness(50 * time.Millisecond)
+	r := gin.New()
+	r.GET("/healthz", Liveness)
+	r.GET("/readyz", readiness.Handler)
+
+	probe := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, body
+	}
+
+	if code, _ := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("not ready status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	readiness.SetReady(true)
+	readiness.AddCheck("redis", func(ctx context.Context) error { return nil })
+	if code, body := probe("/readyz"); code != http.StatusOK || body["status"] != "ready" {
+		t.Fatalf("ready status = %d, body = %v", code, body)
+	}
+
+	// 卡住的依赖不能拖住探针
+	readiness.AddCheck("search", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	readiness.AddCheck("database", func(ctx context.Context) error { return errors.New("connection refused") })
+	start := time.Now()
+	code, body := probe("/readyz")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("probe took %s", elapsed)
+	}
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	checks := body["checks"].(map[string]interface{})
+	for name, want := range map[string]string{"redis": "up", "search": "down", "database": "down"} {
+		result := checks[name].(map[string]interface{})
+		if result["status"] != want {
+			t.Fatalf("%s = %v, want %s", name, result, want)
+		}
+		if _, ok := result["latency_ms"]; !ok {
+			t.Fatalf("%s has no latency", name)
+		}
+	}
+
+	// 依赖故障不影响存活探针
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Fatalf("liveness status = %d, want %d", code, http.StatusOK)
+	}
+}
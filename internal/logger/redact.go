@@ -0,0 +1,95 @@
+// internal/logger/redact.go
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive attributes.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys 中的键（不区分大小写）的值一律替换为 Redacted
+var sensitiveKeys = map[string]bool{
+	"token":         true,
+	"code":          true,
+	"secret":        true,
+	"cookie":        true,
+	"password":      true,
+	"authorization": true,
+	"state":         true,
+	"session_id":    true,
+	"set-cookie":    true,
+}
+
+// 以这些后缀结尾的键同样视为敏感，例如 access_token、client_secret
+var sensitiveSuffixes = []string{"_token", "_secret", "_password", "_cookie"}
+
+// IsSensitiveKey reports whether values logged under key are scrubbed.
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactingHandler scrubs sensitive attributes, including those in groups
+// and those added with Logger.With, before passing records on.
+type redactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps next so that values of sensitive keys such as
+// token, code, secret and cookie never reach it.
+func NewRedactingHandler(next slog.Handler) slog.Handler {
+	return &redactingHandler{next: next}
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	scrubbed := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		scrubbed.AddAttrs(redact(a))
+		return true
+	})
+	return h.next.Handle(ctx, scrubbed)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		scrubbed[i] = redact(a)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(scrubbed)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+func redact(a slog.Attr) slog.Attr {
+	if IsSensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	// 先解析 LogValuer，组内的属性逐个检查
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		scrubbed := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			scrubbed[i] = redact(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(scrubbed...)}
+	}
+	return a
+}
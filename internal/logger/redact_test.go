@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactingHandler(t *testing.T) {
+	for _, format := range []string{"json", "text"} {
+		var buf bytes.Buffer
+		l := New(&buf, slog.LevelDebug, format).With("client_secret", "s-with")
+
+		l.Info("login",
+			"code", "s-code",
+			"Authorization", "Bearer s-auth",
+			"refresh_token", "s-refresh",
+			"user_id", "42",
+			slog.Group("request", "cookie", "s-cookie", "path", "/callback"),
+		)
+		l.WithGroup("oauth").Info("exchange", "token", "s-token")
+
+		out := buf.String()
+		if strings.Contains(out, "s-") {
+			t.Fatalf("%s output leaks a secret: %s", format, out)
+		}
+		for _, want := range []string{Redacted, "42", "/callback"} {
+			if !strings.Contains(out, want) {
+				t.Fatalf("%s output is missing %q: %s", format, want, out)
+			}
+		}
+	}
+}
+
+func TestIsSensitiveKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"token":        true,
+		"Access_Token": true,
+		"session_id":   true,
+		"user_id":      false,
+		"status_code":  false,
+		"error":        false,
+	} {
+		if got := IsSensitiveKey(key); got != want {
+			t.Errorf("IsSensitiveKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// internal/metrics/metrics.go
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric exposed on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route template and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpPanics = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_panics_total",
+		Help: "Panics recovered while serving HTTP requests, by route template.",
+	}, []string{"route"})
+
+	oauthLogins = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "oauth_logins_total",
+		Help: "OAuth login callbacks by provider and outcome.",
+	}, []string{"provider", "outcome"})
+
+	redisDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "redis_command_duration_seconds",
+		Help:    "Redis command latency by command and outcome.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+}
+
+// ObserveRequest records a served HTTP request. route is the route template,
+// never the raw path, to keep label cardinality bounded.
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, code).Inc()
+	httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// ObservePanic records a panic recovered while serving route.
+func ObservePanic(route string) {
+	httpPanics.WithLabelValues(route).Inc()
+}
+
+// OAuth login outcomes.
+const (
+	LoginSuccess       = "success"
+	LoginInvalidState  = "invalid_state"
+	LoginExchangeError = "exchange_error"
+	LoginUserInfoError = "userinfo_error"
+	LoginIssueError    = "issue_error"
+)
+
+// ObserveLogin records the outcome of an OAuth callback.
+func ObserveLogin(provider, outcome string) {
+	oauthLogins.WithLabelValues(provider, outcome).Inc()
+}
+
+var (
+	activeSessionsOnce sync.Once
+	// activeSessions 是最近一次计数的结果，按 math.Float64bits 保存
+	activeSessions atomic.Uint64
+)
+
+// RegisterActiveSessions exposes the number of live sessions as the
+// active_sessions gauge. Counting may scan the whole session store, so it
+// doesn't happen on scrapes: count runs once right away and then every
+// interval until ctx is done, and scrapes report the last result, or NaN if
+// it failed. The gauge is registered once, so building the application again
+// in the same process is safe.
+func RegisterActiveSessions(ctx context.Context, count func(ctx context.Context) (int, error), interval time.Duration) {
+	activeSessionsOnce.Do(func() {
+		activeSessions.Store(math.Float64bits(math.NaN()))
+		factory.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "active_sessions",
+			Help: "Number of live user sessions.",
+		}, func() float64 {
+			return math.Float64frombits(activeSessions.Load())
+		})
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			countCtx, cancel := context.WithTimeout(ctx, interval)
+			n, err := count(countCtx)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Error("failed to count sessions", "error", err)
+				activeSessions.Store(math.Float64bits(math.NaN()))
+			} else {
+				activeSessions.Store(math.Float64bits(float64(n)))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,55 @@
+// internal/metrics/redis.go
+package metrics
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisHook 记录每条 Redis 命令的耗时，pipeline 和事务按整体计为一次调用
+type redisHook struct{}
+
+// RedisHook returns a go-redis hook recording command latency in
+// redis_command_duration_seconds. Install it with client.AddHook.
+func RedisHook() redis.Hook {
+	return redisHook{}
+}
+
+func (redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		conn, err := next(ctx, network, addr)
+		observeRedis("dial", start, err)
+		return conn, err
+	}
+}
+
+func (redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		observeRedis(cmd.Name(), start, err)
+		return err
+	}
+}
+
+func (redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		observeRedis("pipeline", start, err)
+		return err
+	}
+}
+
+func observeRedis(command string, start time.Time, err error) {
+	// redis.Nil 表示键不存在，不算失败
+	outcome := "ok"
+	if err != nil && err != redis.Nil {
+		outcome = "error"
+	}
+	redisDuration.WithLabelValues(command, outcome).Observe(time.Since(start).Seconds())
+}
@@ -1 +1,177 @@
 package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/types"
+)
+
+const (
+	// UserInfoKey 是已认证用户信息在 gin.Context 中的键
+	UserInfoKey = "user_info"
+	// TokenKey 是已认证用户 OAuth token 在 gin.Context 中的键
+	TokenKey = "oauth_token"
+	// AuthMethodKey 记录请求的认证方式，取值为 AuthMethod* 常量之一
+	AuthMethodKey = "auth_method"
+	// ScopesKey 是受限凭证（个人访问令牌）被授予的 scope 列表
+	ScopesKey = "scopes"
+)
+
+// authFailedKey 标记 Authenticate 拒绝了请求中的 bearer token，供 LimitFailedAuth 计数
+const authFailedKey = "auth_failed"
+
+const (
+	AuthMethodSession = "session"
+	AuthMethodBearer  = "bearer"
+	AuthMethodPAT     = "pat"
+)
+
+// Authenticate identifies the caller and stores the user info in the context.
+// Requests with an "Authorization: Bearer" header are authenticated with the
+// JWT access token or personal access token only, and rejected if it is
+// invalid; otherwise the session referenced by the request cookie is loaded,
+// if any. Requests without credentials continue anonymously; use RequireAuth
+// to reject them. tokens and pats may be nil to disable that kind of bearer
+// token.
+func Authenticate(sm types.SessionManager, tokens *auth.TokenService, pats *auth.PATService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if raw, ok := bearerToken(c); ok {
+			var (
+				userInfo map[string]interface{}
+				scopes   []string
+				method   string
+				err      error
+			)
+			switch {
+			case strings.HasPrefix(raw, auth.PATPrefix) && pats != nil:
+				userInfo, scopes, err = pats.Verify(c.Request.Context(), raw)
+				method = AuthMethodPAT
+			case !strings.HasPrefix(raw, auth.PATPrefix) && tokens != nil:
+				userInfo, err = tokens.VerifyAccessToken(raw)
+				method = AuthMethodBearer
+			default:
+				err = errors.New("bearer token type not enabled")
+			}
+			if err != nil {
+				if !errors.Is(err, auth.ErrInvalidAccessToken) && !errors.Is(err, auth.ErrInvalidPAT) {
+					logger.FromContext(c.Request.Context()).Error("failed to verify bearer token", "error", err)
+				}
+				c.Set(authFailedKey, true)
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+				return
+			}
+
+			c.Set(UserInfoKey, userInfo)
+			c.Set(AuthMethodKey, method)
+			if method == AuthMethodPAT {
+				c.Set(ScopesKey, scopes)
+			}
+			c.Next()
+			return
+		}
+
+		token, userInfo, err := sm.GetSession(c)
+		switch {
+		case err == nil:
+			c.Set(TokenKey, token)
+			c.Set(UserInfoKey, userInfo)
+			c.Set(AuthMethodKey, AuthMethodSession)
+		case errors.Is(err, http.ErrNoCookie):
+		case errors.Is(err, auth.ErrSessionExpired), errors.Is(err, auth.ErrSessionNotFound), errors.Is(err, auth.ErrTamperedValue):
+			// 会话已失效，清除浏览器中的 cookie
+			sm.ClearCookie(c)
+		case errors.Is(err, auth.ErrUnknownKey):
+			// 会话可能在其他实例上仍然有效，保留 cookie
+		default:
+			logger.FromContext(c.Request.Context()).Error("failed to load session", "error", err)
+		}
+		c.Next()
+	}
+}
+
+// RequireAuth rejects requests that Authenticate did not attach a user to.
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentUser(c); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests authenticated with a personal access token
+// that was not granted scope. Sessions and JWT access tokens act with the
+// user's full access.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, ok := c.Get(ScopesKey); ok {
+			scopes, _ := value.([]string)
+			if !slices.Contains(scopes, scope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token lacks required scope " + scope})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireAuthMethod rejects requests authenticated by any method other than
+// the given ones, e.g. to keep personal access tokens from managing tokens.
+func RequireAuthMethod(methods ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(methods, c.GetString(AuthMethodKey)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Authentication method not allowed"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects requests from users whose email is not in emails or
+// was not verified by the identity provider, since an unverified email may
+// belong to someone else. It must run after RequireAuth.
+func RequireAdmin(emails []string) gin.HandlerFunc {
+	admins := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		admins[strings.ToLower(email)] = true
+	}
+	return func(c *gin.Context) {
+		userInfo, _ := CurrentUser(c)
+		email, _ := userInfo["email"].(string)
+		verified, _ := userInfo["email_verified"].(bool)
+		if email == "" || !verified || !admins[strings.ToLower(email)] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser returns the user info attached by Authenticate.
+func CurrentUser(c *gin.Context) (map[string]interface{}, bool) {
+	value, ok := c.Get(UserInfoKey)
+	if !ok {
+		return nil, false
+	}
+	userInfo, ok := value.(map[string]interface{})
+	return userInfo, ok
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
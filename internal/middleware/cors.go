@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSPolicy configures cross-origin access for browsers. An empty
+// AllowedOrigins disables CORS: no CORS headers are sent and browsers keep
+// enforcing the same-origin policy.
+type CORSPolicy struct {
+	// AllowedOrigins 是完整的 origin，如 "https://app.example.com"；"*" 允许任意 origin，
+	// 但不能与 AllowCredentials 同时使用
+	AllowedOrigins   []string
+	AllowCredentials bool
+	// AllowedMethods 和 AllowedHeaders 为空时使用 DefaultCORSMethods 和 DefaultCORSHeaders
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	// MaxAge 是浏览器缓存预检结果的时间
+	MaxAge time.Duration
+}
+
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	DefaultCORSHeaders = []string{"Authorization", "Content-Type", CSRFHeader, RequestIDHeader}
+)
+
+// CORS answers preflight requests and adds CORS headers to cross-origin
+// requests. groups overrides defaultPolicy for route groups by path prefix
+// (e.g. "/admin"); the longest matching prefix wins and its policy replaces
+// the default entirely. It runs before routing decisions, so it must be
+// registered on the engine rather than on a group for preflight requests to
+// reach it.
+func CORS(defaultPolicy CORSPolicy, groups map[string]CORSPolicy) gin.HandlerFunc {
+	defaultPolicy = withCORSDefaults(defaultPolicy)
+	groupPolicies := make(map[string]CORSPolicy, len(groups))
+	for prefix, policy := range groups {
+		groupPolicies[prefix] = withCORSDefaults(policy)
+	}
+
+	return func(c *gin.Context) {
+		policy := defaultPolicy
+		if p, ok := groupPolicy(c.Request.URL.Path, groupPolicies); ok {
+			policy = p
+		}
+		origin := c.GetHeader("Origin")
+		if origin == "" || len(policy.AllowedOrigins) == 0 {
+			c.Next()
+			return
+		}
+
+		// 响应随 Origin 不同而不同，避免被缓存后发给其他 origin
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		allowed := slices.Contains(policy.AllowedOrigins, origin) || slices.Contains(policy.AllowedOrigins, "*")
+		if !allowed {
+			if preflight {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if slices.Contains(policy.AllowedOrigins, "*") && !policy.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if policy.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			c.Header("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+			c.Header("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			if policy.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if len(policy.ExposedHeaders) > 0 {
+			c.Header("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+		}
+		c.Next()
+	}
+}
+
+func withCORSDefaults(p CORSPolicy) CORSPolicy {
+	if len(p.AllowedMethods) == 0 {
+		p.AllowedMethods = DefaultCORSMethods
+	}
+	if len(p.AllowedHeaders) == 0 {
+		p.AllowedHeaders = DefaultCORSHeaders
+	}
+	return p
+}
+
+// groupPolicy 按路径前缀查找路由组的策略，前缀按路径段匹配，最长的前缀优先
+func groupPolicy[T any](path string, groups map[string]T) (T, bool) {
+	var (
+		best    T
+		bestLen = -1
+	)
+	for prefix, policy := range groups {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if len(prefix) > bestLen {
+			best, bestLen = policy, len(prefix)
+		}
+	}
+	return best, bestLen >= 0
+}
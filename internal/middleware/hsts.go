@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HSTS sets Strict-Transport-Security on responses served over TLS, telling
+// browsers to use HTTPS for the host for maxAge. The header is ignored on
+// plain HTTP responses, so it is only sent on TLS connections.
+func HSTS(maxAge time.Duration, includeSubdomains bool) gin.HandlerFunc {
+	value := "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", value)
+		}
+		c.Next()
+	}
+}
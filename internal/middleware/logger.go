@@ -2,9 +2,83 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDHeader 是传递请求 ID 的请求头和响应头
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey 是请求 ID 在 gin.Context 中的键
+	RequestIDKey = "request_id"
 )
 
+// 只接受长度合理、字符安全的外部请求 ID，避免日志注入
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID assigns each request an ID, reusing a well-formed incoming
+// X-Request-ID, echoes it in the response, and stores a logger carrying it
+// in the request context for logger.FromContext. It should run after the
+// tracing middleware so the logger also carries the trace ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		ctx := c.Request.Context()
+		l := logger.FromContext(ctx).With(slog.String("request_id", id))
+		// 开启追踪时，日志带上 trace ID 以便和 span 关联
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			l = l.With(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+		}
+		c.Request = c.Request.WithContext(logger.WithContext(ctx, l))
+		c.Next()
+	}
+}
+
+// Logger writes one structured access log entry per request. It should run
+// after RequestID.
 func Logger() gin.HandlerFunc {
-	return gin.Logger()
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		logger.FromContext(c.Request.Context()).LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logger.New(&buf, slog.LevelInfo, "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	r := gin.New()
+	r.Use(RequestID(), Logger())
+	r.GET("/users/:id", func(c *gin.Context) {
+		logger.FromContext(c.Request.Context()).Info("handler")
+		c.Status(http.StatusOK)
+	})
+
+	request := func(requestID string) string {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header().Get(RequestIDHeader)
+	}
+
+	if got := request("abc-123"); got != "abc-123" {
+		t.Fatalf("request ID = %q, want incoming ID", got)
+	}
+
+	// handler 日志和访问日志都应带上同一个请求 ID
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry["request_id"] != "abc-123" {
+			t.Fatalf("entry %v has no request ID", entry)
+		}
+	}
+	if access := entries[1]; access["route"] != "/users/:id" || access["status"] != float64(http.StatusOK) {
+		t.Fatalf("access log = %v", access)
+	}
+
+	if got := request("bad id\n"); got == "" || got == "bad id\n" {
+		t.Fatalf("request ID = %q, want a generated ID", got)
+	}
+	if request("") == request("") {
+		t.Fatal("generated request IDs are not unique")
+	}
+}
+
+func TestRequestLoggerCarriesTraceID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logger.New(&buf, slog.LevelInfo, "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	r := gin.New()
+	r.Use(otelgin.Middleware("test", otelgin.WithTracerProvider(provider)), RequestID())
+	r.GET("/", func(c *gin.Context) {
+		logger.FromContext(c.Request.Context()).Info("handler")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["trace_id"] != spans[0].SpanContext().TraceID().String() {
+		t.Fatalf("log entry %v does not carry trace ID %s", entry, spans[0].SpanContext().TraceID())
+	}
+}
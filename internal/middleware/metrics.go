@@ -0,0 +1,25 @@
+// internal/middleware/metrics.go
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/metrics"
+)
+
+// Metrics records request count and latency by route template and status.
+// Requests that match no route are grouped under "unmatched" so arbitrary
+// paths can't create new series.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
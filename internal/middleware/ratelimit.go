@@ -0,0 +1,307 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/auth"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitPolicy limits a client to Limit requests per sliding Window.
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+	// By 为 "ip" 或 "user"；按用户限流时未认证的请求按 IP 计数
+	By string
+}
+
+// RateLimitResult is the outcome of a RateLimiter.Allow call.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter 是窗口内最早的请求过期、腾出配额所需的时间
+	ResetAfter time.Duration
+}
+
+// RateLimiter counts requests per key in a sliding window.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+	// Peek reports whether a request for key would be allowed without
+	// counting it.
+	Peek(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// RateLimitRules holds the policies applied by RateLimitWithRules. They can
+// be replaced while serving, e.g. when the config is reloaded.
+type RateLimitRules struct {
+	current    atomic.Pointer[rateLimitRules]
+	failedAuth atomic.Pointer[RateLimitPolicy]
+}
+
+type rateLimitRules struct {
+	defaultPolicy RateLimitPolicy
+	routes        map[string]RateLimitPolicy
+}
+
+// NewRateLimitRules creates rules applying the policy registered for the
+// matched route template, or defaultPolicy if there is none.
+func NewRateLimitRules(defaultPolicy RateLimitPolicy, routes map[string]RateLimitPolicy) *RateLimitRules {
+	r := &RateLimitRules{}
+	r.Update(defaultPolicy, routes)
+	return r
+}
+
+// Update atomically replaces all policies. A zero defaultPolicy with no
+// routes turns rate limiting off.
+func (r *RateLimitRules) Update(defaultPolicy RateLimitPolicy, routes map[string]RateLimitPolicy) {
+	copied := make(map[string]RateLimitPolicy, len(routes))
+	for route, policy := range routes {
+		copied[route] = policy
+	}
+	r.current.Store(&rateLimitRules{defaultPolicy: defaultPolicy, routes: copied})
+}
+
+// UpdateFailedAuth replaces the policy applied by LimitFailedAuth. A zero
+// policy turns it off.
+func (r *RateLimitRules) UpdateFailedAuth(policy RateLimitPolicy) {
+	r.failedAuth.Store(&policy)
+}
+
+func (r *RateLimitRules) policy(route string) (string, RateLimitPolicy) {
+	rules := r.current.Load()
+	if policy, ok := rules.routes[route]; ok {
+		return route, policy
+	}
+	return "default", rules.defaultPolicy
+}
+
+// RateLimit applies the policy registered for the matched route template
+// (c.FullPath()), or defaultPolicy if there is none. It must run after
+// Authenticate for per-user policies to see the user. Limiter errors are
+// logged and the request is let through.
+func RateLimit(limiter RateLimiter, defaultPolicy RateLimitPolicy, routes map[string]RateLimitPolicy) gin.HandlerFunc {
+	return RateLimitWithRules(limiter, NewRateLimitRules(defaultPolicy, routes))
+}
+
+// RateLimitWithRules is RateLimit with policies that can be updated later.
+func RateLimitWithRules(limiter RateLimiter, rules *RateLimitRules) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, policy := rules.policy(c.FullPath())
+		if policy.Limit <= 0 || policy.Window <= 0 {
+			c.Next()
+			return
+		}
+
+		key := fmt.Sprintf("ratelimit:%s:%s", route, rateLimitIdentity(c, policy))
+		result, err := limiter.Allow(c.Request.Context(), key, policy.Limit, policy.Window)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error("rate limiter error", "error", err)
+			c.Next()
+			return
+		}
+
+		resetSeconds := int(math.Ceil(result.ResetAfter.Seconds()))
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(resetSeconds))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(resetSeconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// LimitFailedAuth limits how many invalid bearer tokens and personal access
+// tokens a client IP may present per window, as set with
+// RateLimitRules.UpdateFailedAuth. It must run before Authenticate: once the
+// limit is reached, requests with a bearer token are rejected before the
+// token is looked up, so a correct guess doesn't get through either.
+// Requests without a bearer token are not affected.
+func LimitFailedAuth(limiter RateLimiter, rules *RateLimitRules) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := rules.failedAuth.Load()
+		if _, ok := bearerToken(c); !ok || policy == nil || policy.Limit <= 0 || policy.Window <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key := "ratelimit:failed_auth:ip:" + c.ClientIP()
+		result, err := limiter.Peek(ctx, key, policy.Limit, policy.Window)
+		if err != nil {
+			logger.FromContext(ctx).Error("rate limiter error", "error", err)
+		} else if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+
+		c.Next()
+
+		// 只有 Authenticate 拒绝的凭证才计数
+		if c.GetBool(authFailedKey) {
+			if _, err := limiter.Allow(ctx, key, policy.Limit, policy.Window); err != nil {
+				logger.FromContext(ctx).Error("rate limiter error", "error", err)
+			}
+		}
+	}
+}
+
+func rateLimitIdentity(c *gin.Context, policy RateLimitPolicy) string {
+	if policy.By == "user" {
+		if userInfo, ok := CurrentUser(c); ok {
+			if userID := auth.SessionUserID(userInfo); userID != "" {
+				return "user:" + userID
+			}
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// redisRateLimiter 使用有序集合实现滑动窗口日志，多实例共享计数
+type redisRateLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisRateLimiter creates a RateLimiter whose counters are shared by all
+// instances through Redis.
+func NewRedisRateLimiter(client *redis.Client) RateLimiter {
+	return &redisRateLimiter{client: client}
+}
+
+// slidingWindowScript 的时间单位为微秒。
+// ARGV[4] 为空时只查询不计数。
+// 返回 {是否允许, 剩余次数, 距离释放配额的微秒数}
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if ARGV[4] == '' then
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	local reset = 0
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window - now
+	end
+	if count < limit then
+		return {1, limit - count, reset}
+	end
+	return {0, 0, reset}
+end
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, math.ceil(window / 1000))
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	return {1, limit - count - 1, tonumber(oldest[2]) + window - now}
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+func (l *redisRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	now := time.Now().UnixMicro()
+	// 同一微秒内的请求需要不同的成员，否则 ZADD 会覆盖
+	member := strconv.FormatInt(now, 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+	return l.run(ctx, key, limit, window, now, member)
+}
+
+func (l *redisRateLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	return l.run(ctx, key, limit, window, time.Now().UnixMicro(), "")
+}
+
+func (l *redisRateLimiter) run(ctx context.Context, key string, limit int, window time.Duration, now int64, member string) (RateLimitResult, error) {
+	values, err := slidingWindowScript.Run(ctx, l.client, []string{key}, now, window.Microseconds(), limit, member).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  int(values[1]),
+		ResetAfter: time.Duration(values[2]) * time.Microsecond,
+	}, nil
+}
+
+// memoryRateLimiter 是进程内的滑动窗口实现，用于测试和单节点开发
+type memoryRateLimiter struct {
+	mu       sync.Mutex
+	requests map[string]*requestLog
+	lastGC   time.Time
+}
+
+type requestLog struct {
+	times  []time.Time
+	window time.Duration
+}
+
+// NewMemoryRateLimiter creates a RateLimiter that counts in process memory.
+func NewMemoryRateLimiter() RateLimiter {
+	return &memoryRateLimiter{requests: make(map[string]*requestLog), lastGC: time.Now()}
+}
+
+func (l *memoryRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	return l.check(key, limit, window, true), nil
+}
+
+func (l *memoryRateLimiter) Peek(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	return l.check(key, limit, window, false), nil
+}
+
+func (l *memoryRateLimiter) check(key string, limit int, window time.Duration, record bool) RateLimitResult {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 定期清理窗口内已没有请求的键
+	if now.Sub(l.lastGC) > time.Minute {
+		for k, rl := range l.requests {
+			if len(rl.times) == 0 || now.Sub(rl.times[len(rl.times)-1]) > rl.window {
+				delete(l.requests, k)
+			}
+		}
+		l.lastGC = now
+	}
+
+	rl, ok := l.requests[key]
+	if !ok {
+		rl = &requestLog{}
+		l.requests[key] = rl
+	}
+	rl.window = window
+
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(rl.times) && !rl.times[i].After(cutoff) {
+		i++
+	}
+	rl.times = rl.times[i:]
+
+	result := RateLimitResult{Limit: limit}
+	if len(rl.times) < limit {
+		if record {
+			rl.times = append(rl.times, now)
+		}
+		result.Allowed = true
+		result.Remaining = limit - len(rl.times)
+	}
+	if len(rl.times) > 0 {
+		result.ResetAfter = rl.times[0].Add(window).Sub(now)
+	}
+	return result
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/auth"
+)
+
+func TestRateLimitPerRoutePolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimit(NewMemoryRateLimiter(),
+		RateLimitPolicy{Limit: 100, Window: time.Minute, By: "ip"},
+		map[string]RateLimitPolicy{
+			"/auth/:provider/login": {Limit: 2, Window: time.Minute, By: "ip"},
+		}))
+	r.GET("/auth/:provider/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/search", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 策略按路由模板计数，不同 provider 共享同一配额
+	for i, path := range []string{"/auth/google/login", "/auth/apple/login"} {
+		w := request(path, "10.0.0.1")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d", i, w.Code)
+		}
+		if got, want := w.Header().Get("X-RateLimit-Remaining"), []string{"1", "0"}[i]; got != want {
+			t.Fatalf("request %d remaining = %s, want %s", i, got, want)
+		}
+	}
+
+	w := request("/auth/google/login", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") != "60" || w.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Fatalf("headers = %v", w.Header())
+	}
+
+	if w := request("/auth/google/login", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("other IP status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := request("/search", "10.0.0.1"); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "100" {
+		t.Fatalf("default policy: status = %d, headers = %v", w.Code, w.Header())
+	}
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set(UserInfoKey, map[string]interface{}{"id": user})
+		}
+	})
+	r.Use(RateLimit(NewMemoryRateLimiter(), RateLimitPolicy{Limit: 1, Window: time.Minute, By: "user"}, nil))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(user string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Test-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 同一 IP 下的不同用户各自计数
+	if code := request("alice"); code != http.StatusOK {
+		t.Fatalf("alice status = %d", code)
+	}
+	if code := request("bob"); code != http.StatusOK {
+		t.Fatalf("bob status = %d", code)
+	}
+	if code := request("alice"); code != http.StatusTooManyRequests {
+		t.Fatalf("alice second status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitRulesUpdate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rules := NewRateLimitRules(RateLimitPolicy{Limit: 1, Window: time.Minute, By: "ip"}, nil)
+	r := gin.New()
+	r.Use(RateLimitWithRules(NewMemoryRateLimiter(), rules))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	request()
+	if w := request(); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	// 更新后的策略立即生效，无需重建中间件
+	rules.Update(RateLimitPolicy{Limit: 5, Window: time.Minute, By: "ip"}, nil)
+	if w := request(); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "5" {
+		t.Fatalf("after update: status = %d, headers = %v", w.Code, w.Header())
+	}
+
+	rules.Update(RateLimitPolicy{}, nil)
+	if w := request(); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("after disabling: status = %d, headers = %v", w.Code, w.Header())
+	}
+}
+
+func TestLimitFailedAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sm := auth.NewMemorySessionManager(auth.SessionOptions{})
+	t.Cleanup(func() { sm.Close() })
+	key, err := auth.GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := auth.NewTokenService(sm, auth.TokenOptions{
+		Issuer:      "test",
+		Audience:    "test-api",
+		SigningKeys: map[string]*ecdsa.PrivateKey{"k1": key},
+		ActiveKeyID: "k1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := ts.IssueTokens(context.Background(), map[string]interface{}{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := NewRateLimitRules(RateLimitPolicy{}, nil)
+	rules.UpdateFailedAuth(RateLimitPolicy{Limit: 2, Window: time.Minute, By: "ip"})
+	r := gin.New()
+	r.Use(LimitFailedAuth(NewMemoryRateLimiter(), rules), Authenticate(sm, ts, nil))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(ip, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 有效 token 不计入失败次数
+	if code := request("10.0.0.1", tokens.AccessToken); code != http.StatusOK {
+		t.Fatalf("valid token status = %d", code)
+	}
+	for i := 0; i < 2; i++ {
+		if code := request("10.0.0.1", "guess"); code != http.StatusUnauthorized {
+			t.Fatalf("bad token %d status = %d, want 401", i, code)
+		}
+	}
+	// 达到上限后，即使猜中也不会被接受
+	if code := request("10.0.0.1", "guess"); code != http.StatusTooManyRequests {
+		t.Errorf("bad token over limit status = %d, want 429", code)
+	}
+	if code := request("10.0.0.1", tokens.AccessToken); code != http.StatusTooManyRequests {
+		t.Errorf("valid token over limit status = %d, want 429", code)
+	}
+	if code := request("10.0.0.1", ""); code != http.StatusOK {
+		t.Errorf("request without token status = %d, want 200", code)
+	}
+	if code := request("10.0.0.2", tokens.AccessToken); code != http.StatusOK {
+		t.Errorf("other IP status = %d, want 200", code)
+	}
+}
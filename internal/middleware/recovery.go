@@ -0,0 +1,97 @@
+// internal/middleware/recovery.go
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/metrics"
+)
+
+// PanicEvent describes a panic recovered while serving a request.
+type PanicEvent struct {
+	Err       error
+	Stack     []byte
+	RequestID string
+	Method    string
+	Route     string
+}
+
+// ErrorReporter forwards recovered panics to an external error tracking
+// service. Report is called synchronously on the request goroutine, so
+// implementations that talk to the network should hand the event off.
+type ErrorReporter interface {
+	Report(ctx context.Context, event PanicEvent)
+}
+
+// ErrorReporterFunc adapts a function to ErrorReporter.
+type ErrorReporterFunc func(ctx context.Context, event PanicEvent)
+
+// Report calls f(ctx, event).
+func (f ErrorReporterFunc) Report(ctx context.Context, event PanicEvent) {
+	f(ctx, event)
+}
+
+// Recovery turns a panic in a later handler into a 500 with the standard
+// error body. The panic and its stack trace are logged through the request
+// logger, counted in http_panics_total and, if reporter is not nil, passed
+// to it. It should run after RequestID, Logger and Metrics so the failed
+// request is still logged and measured.
+func Recovery(reporter ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// http.ErrAbortHandler 用于主动中断响应，交给 net/http 处理
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			err, ok := rec.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rec)
+			}
+			ctx := c.Request.Context()
+			route := c.FullPath()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			// 客户端已断开连接时无法写响应，也不算服务端错误
+			if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+				logger.FromContext(ctx).Warn("client connection closed", "error", err)
+				c.Abort()
+				return
+			}
+
+			stack := debug.Stack()
+			logger.FromContext(ctx).Error("panic recovered", "error", err, "route", route, "stack", string(stack))
+			metrics.ObservePanic(route)
+			if reporter != nil {
+				reporter.Report(ctx, PanicEvent{
+					Err:       err,
+					Stack:     stack,
+					RequestID: c.GetString(RequestIDKey),
+					Method:    c.Request.Method,
+					Route:     route,
+				})
+			}
+
+			// 响应已经开始写出时只能中断
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}()
+		c.Next()
+	}
+}
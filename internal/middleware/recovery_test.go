@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/logger"
+	"github.com/majiayu000/gin-starter/internal/metrics"
+)
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logger.New(&buf, slog.LevelInfo, "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	var events []PanicEvent
+	reporter := ErrorReporterFunc(func(_ context.Context, event PanicEvent) {
+		events = append(events, event)
+	})
+
+	r := gin.New()
+	r.Use(RequestID(), Recovery(reporter))
+	r.GET("/panic/:id", func(c *gin.Context) {
+		var info map[string]interface{}
+		_ = info["id"].(string)
+	})
+	r.GET("/metrics", metrics.Handler())
+
+	req := httptest.NewRequest(http.MethodGet, "/panic/1", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] != "Internal server error" {
+		t.Errorf("body = %s, want standard error body", w.Body.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry: %v", err)
+	}
+	if entry["request_id"] != "req-1" || entry["route"] != "/panic/:id" {
+		t.Errorf("log entry = %v, want request ID and route", entry)
+	}
+	if stack, _ := entry["stack"].(string); !strings.Contains(stack, "recovery_test.go") {
+		t.Error("log entry has no stack trace")
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("reported %d events, want 1", len(events))
+	}
+	if events[0].RequestID != "req-1" || events[0].Route != "/panic/:id" || events[0].Err == nil {
+		t.Errorf("event = %+v", events[0])
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `http_panics_total{route="/panic/:id"} 1`) {
+		t.Error("metrics missing http_panics_total")
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newSecurityTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORS(
+		CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true, ExposedHeaders: []string{"X-Request-ID"}, MaxAge: 10 * time.Minute},
+		map[string]CORSPolicy{"/admin": {}},
+	))
+	r.Use(SecurityHeaders(
+		SecurityHeadersPolicy{ContentSecurityPolicy: "default-src 'none'", FrameOptions: "DENY"},
+		map[string]SecurityHeadersPolicy{"/docs": {ContentSecurityPolicy: "default-src 'self'"}},
+	))
+	r.GET("/api/items", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/admin/providers", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/docs/index", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestCORS(t *testing.T) {
+	r := newSecurityTestRouter()
+	request := func(method, path, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 预检请求没有匹配的路由，也要由 CORS 中间件应答
+	w := request(http.MethodOptions, "/api/items", "https://app.example.com", true)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	h := w.Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" ||
+		h.Get("Access-Control-Max-Age") != "600" || h.Get("Access-Control-Allow-Methods") == "" {
+		t.Fatalf("preflight headers = %v", h)
+	}
+
+	if w := request(http.MethodOptions, "/api/items", "https://evil.example", true); w.Code != http.StatusForbidden {
+		t.Fatalf("preflight from other origin status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = request(http.MethodGet, "/api/items", "https://app.example.com", false)
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || w.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Fatalf("actual request headers = %v", w.Header())
+	}
+	if w := request(http.MethodGet, "/api/items", "https://evil.example", false); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("other origin got CORS headers: %v", w.Header())
+	}
+
+	// /admin 组覆盖为不允许跨域
+	if w := request(http.MethodPost, "/admin/providers", "https://app.example.com", false); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("/admin got CORS headers: %v", w.Header())
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	r := newSecurityTestRouter()
+	serve := func(path string) http.Header {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header()
+	}
+
+	h := serve("/api/items")
+	if h.Get("Content-Security-Policy") != "default-src 'none'" || h.Get("X-Frame-Options") != "DENY" || h.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("default headers = %v", h)
+	}
+
+	// 组策略整体替换默认策略
+	h = serve("/docs/index")
+	if h.Get("Content-Security-Policy") != "default-src 'self'" || h.Get("X-Frame-Options") != "" {
+		t.Fatalf("/docs headers = %v", h)
+	}
+	if h := serve("/docsx"); h.Get("Content-Security-Policy") != "default-src 'none'" {
+		t.Fatalf("prefix matched a different path segment: %v", h)
+	}
+}
@@ -0,0 +1,105 @@
+// internal/middleware/timeout.go
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/gin-starter/internal/logger"
+)
+
+// Timeout gives each request a time budget: defaultBudget, or the budget of
+// the longest matching route group prefix in groups. A budget of 0 means no
+// limit. The budget is set as the deadline of c.Request.Context(), so
+// handlers, the session manager and OAuth calls that use that context give
+// up once it runs out. Handlers run on the request goroutine and must return
+// on their own; if the deadline passed before they wrote a response, the
+// client gets a 504 with the standard error body and anything the handlers
+// write afterwards is discarded. Headers they set, such as Set-Cookie, are
+// dropped too; the 504 carries only the headers set before Timeout ran.
+func Timeout(defaultBudget time.Duration, groups map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		budget := defaultBudget
+		if b, ok := groupPolicy(c.Request.URL.Path, groups); ok {
+			budget = b
+		}
+		if budget <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		// 处理函数设置的 header 不能带到 504 上，超时后恢复到此时的状态
+		header := c.Writer.Header().Clone()
+		w := &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Writer = w
+		// panic 时也要换回原来的 writer，否则 Recovery 的响应会被丢弃
+		defer func() { c.Writer = w.ResponseWriter }()
+		c.Next()
+
+		if w.expired() {
+			c.Writer = w.ResponseWriter
+			h := c.Writer.Header()
+			clear(h)
+			for k, v := range header {
+				h[k] = v
+			}
+			logger.FromContext(ctx).Warn("request timed out", "budget", budget)
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+		}
+	}
+}
+
+// timeoutWriter discards writes made after the deadline, as long as the
+// response has not started yet, so Timeout can reply with a 504 instead.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+}
+
+// expired 报告预算是否已用完且响应尚未开始写出
+func (w *timeoutWriter) expired() bool {
+	if !w.timedOut && !w.ResponseWriter.Written() && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+	}
+	return w.timedOut
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	if w.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) Flush() {
+	if !w.expired() {
+		w.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Header("X-Request-ID", "req-1")
+		c.Next()
+	})
+	r.Use(Timeout(20*time.Millisecond, map[string]time.Duration{"/export": 0}))
+
+	// 遵守 context 的慢处理函数：超时后返回错误，该响应应被 504 取代
+	slow := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			// 超时后设置的 cookie 不能出现在 504 上
+			c.SetCookie("session_id", "new", 0, "/", "", true, true)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load"})
+		case <-time.After(time.Second):
+			c.JSON(http.StatusOK, gin.H{"status": "done"})
+		}
+	}
+	r.GET("/api/slow", slow)
+	r.GET("/export/slow", func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			t.Error("unlimited group has a deadline")
+		}
+		c.Status(http.StatusOK)
+	})
+	r.GET("/api/fast", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/api/slow", http.StatusGatewayTimeout, `{"error":"Request timed out"}`},
+		{"/api/fast", http.StatusOK, `{"status":"ok"}`},
+		{"/export/slow", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %s, want %d %s", tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+		if w.Header().Get("Set-Cookie") != "" || w.Header().Get("X-Request-ID") != "req-1" {
+			t.Errorf("%s: headers = %v", tt.path, w.Header())
+		}
+	}
+}
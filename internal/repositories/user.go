@@ -2,10 +2,24 @@
 package repositories
 
 import (
+	"context"
+
 	"github.com/majiayu000/gin-starter/internal/models"
 )
 
-func GetUser(id string) (*models.User, error) {
+// UserRepository loads users from storage.
+type UserRepository interface {
+	GetUser(ctx context.Context, id string) (*models.User, error)
+}
+
+type userRepository struct{}
+
+// NewUserRepository creates the user repository.
+func NewUserRepository() UserRepository {
+	return &userRepository{}
+}
+
+func (r *userRepository) GetUser(ctx context.Context, id string) (*models.User, error) {
 	// 这里应该是数据库操作
 	// 现在只是返回一个模拟的用户
 	return &models.User{ID: id, Name: "John Doe"}, nil
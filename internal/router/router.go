@@ -2,29 +2,144 @@
 package router
 
 import (
+	"log/slog"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	config "github.com/majiayu000/gin-starter/configs"
+	"github.com/majiayu000/gin-starter/internal/auth"
 	"github.com/majiayu000/gin-starter/internal/handlers"
+	"github.com/majiayu000/gin-starter/internal/health"
+	"github.com/majiayu000/gin-starter/internal/metrics"
 	"github.com/majiayu000/gin-starter/internal/middleware"
+	"github.com/majiayu000/gin-starter/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+// Dependencies are the services and handlers the routes are served by. They
+// are built once by the application container.
+type Dependencies struct {
+	Config *config.Config
+
+	SessionManager types.SessionManager
+	TokenService   *auth.TokenService
+	PATService     *auth.PATService
+	RateLimiter    middleware.RateLimiter
+	RateLimitRules *middleware.RateLimitRules
+	CSRFKey        []byte
+	Readiness      *health.Readiness
+	// ErrorReporter 接收恢复的 panic，可以为 nil
+	ErrorReporter middleware.ErrorReporter
+
+	AuthHandler  *handlers.AuthHandler
+	TokenHandler *handlers.TokenHandler
+	PATHandler   *handlers.PATHandler
+	AdminHandler *handlers.AdminHandler
+	UserHandler  *handlers.UserHandler
+}
+
 // SetupRouter 初始化路由
-func SetupRouter() *gin.Engine {
-	r := gin.Default()
+func SetupRouter(deps Dependencies) *gin.Engine {
+	cfg := deps.Config
+	r := gin.New()
+	// 默认不信任任何代理，否则客户端可以伪造 X-Forwarded-For 绕过按 IP 的限流
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		slog.Error("invalid trusted proxies, trusting none", "error", err)
+		r.SetTrustedProxies(nil)
+	}
 
 	// 使用中间件
-	r.Use(middleware.Logger())
-	// r.GET("/", handlers.HelloWorld)
+	// 探针和指标接口不产生 span
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		switch req.URL.Path {
+		case "/healthz", "/readyz":
+			return false
+		}
+		return true
+	})))
+	r.Use(middleware.RequestID(), middleware.Logger(), middleware.Metrics(), middleware.Recovery(deps.ErrorReporter))
+	if cfg.TLS.Enabled && cfg.TLS.HSTSMaxAge > 0 {
+		r.Use(middleware.HSTS(cfg.TLS.HSTSMaxAge, cfg.TLS.HSTSIncludeSubdomains))
+	}
+	r.Use(Security(cfg)...)
+	r.Use(middleware.Timeout(cfg.RequestTimeout.Default, cfg.RequestTimeout.Groups))
+
+	// 探针不经过会话、认证和限流中间件
+	r.GET("/healthz", health.Liveness)
+	r.GET("/readyz", deps.Readiness.Handler)
+
+	// 在认证之前拦截反复提交无效 token 的客户端
+	r.Use(middleware.LimitFailedAuth(deps.RateLimiter, deps.RateLimitRules))
+	r.Use(middleware.Authenticate(deps.SessionManager, deps.TokenService, deps.PATService))
+	r.Use(middleware.RateLimitWithRules(deps.RateLimiter, deps.RateLimitRules))
+	// token 接口只接受请求体中的 refresh token，不依赖 cookie
+	r.Use(middleware.CSRF(deps.CSRFKey, "/auth/token", "/auth/token/revoke"))
+
 	// 设置路由
-	api := r.Group("/api")
+	r.GET("/", middleware.RequireAuth(), middleware.RequireScope(auth.ScopeProfileRead), deps.AuthHandler.HandleProfile)
+	r.GET("/.well-known/jwks.json", deps.TokenHandler.JWKS)
+	r.POST("/logout", deps.AuthHandler.HandleLogout)
+
+	authGroup := r.Group("/auth")
+	{
+		authGroup.GET("/:provider/login", deps.AuthHandler.HandleGoogleLogin)
+		authGroup.GET("/:provider/callback", deps.AuthHandler.HandleGoogleCallback)
+		authGroup.GET("/csrf", deps.AuthHandler.CSRFToken)
+		authGroup.POST("/token", deps.TokenHandler.Token)
+		authGroup.POST("/token/revoke", deps.TokenHandler.Revoke)
+	}
+
+	api := r.Group("/api", middleware.RequireAuth())
 	{
-		api.GET("/user/:id", handlers.GetUser)
+		// 每个接口都要声明个人访问令牌所需的 scope，或用 RequireAuthMethod 排除个人访问令牌
+		api.GET("/user/:id", middleware.RequireScope(auth.ScopeProfileRead), deps.UserHandler.GetUser)
 		// 在这里添加更多路由
+
+		// 个人访问令牌不能用来管理令牌
+		me := api.Group("/me", middleware.RequireAuthMethod(middleware.AuthMethodSession, middleware.AuthMethodBearer))
+		me.GET("/tokens", deps.PATHandler.List)
+		me.POST("/tokens", deps.PATHandler.Create)
+		me.DELETE("/tokens/:id", deps.PATHandler.Revoke)
 	}
 
-	// root := r.Group("/")
-	// {
-	// 	root.GET("/", handlers.HelloWorld)
-	// }
+	admin := r.Group("/admin", middleware.RequireAuth(),
+		middleware.RequireAuthMethod(middleware.AuthMethodSession, middleware.AuthMethodBearer),
+		middleware.RequireAdmin(cfg.Admin.Emails))
+	{
+		admin.GET("/providers", deps.AdminHandler.ListProviders)
+		admin.POST("/providers/:provider/enable", deps.AdminHandler.EnableProvider)
+		admin.POST("/providers/:provider/disable", deps.AdminHandler.DisableProvider)
+	}
+
+	return r
+}
 
+// SetupMetricsRouter serves /metrics. It is meant for the separate
+// metrics.port, which should only be reachable by the monitoring system.
+func SetupMetricsRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET("/metrics", metrics.Handler())
 	return r
 }
+
+// Security returns the CORS and security header middleware configured in
+// cfg, with the per-group overrides from cors.groups and
+// security_headers.groups. Register it on the engine rather than on a group:
+// CORS preflight requests match no route and only reach engine middleware.
+func Security(cfg *config.Config) []gin.HandlerFunc {
+	corsGroups := make(map[string]middleware.CORSPolicy, len(cfg.CORS.Groups))
+	for prefix, policy := range cfg.CORS.Groups {
+		corsGroups[prefix] = middleware.CORSPolicy(policy)
+	}
+	headerGroups := make(map[string]middleware.SecurityHeadersPolicy, len(cfg.SecurityHeaders.Groups))
+	for prefix, policy := range cfg.SecurityHeaders.Groups {
+		headerGroups[prefix] = middleware.SecurityHeadersPolicy(policy)
+	}
+
+	// 安全响应头在前，CORS 直接应答的预检请求也会带上
+	return []gin.HandlerFunc{
+		middleware.SecurityHeaders(middleware.SecurityHeadersPolicy(cfg.SecurityHeaders.SecurityHeadersPolicy), headerGroups),
+		middleware.CORS(middleware.CORSPolicy(cfg.CORS.CORSPolicy), corsGroups),
+	}
+}
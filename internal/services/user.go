@@ -2,10 +2,20 @@
 package services
 
 import (
+	"context"
+
 	"github.com/majiayu000/gin-starter/internal/models"
 	"github.com/majiayu000/gin-starter/internal/repositories"
 )
 
-func GetUser(id string) (*models.User, error) {
-	return repositories.GetUser(id)
+type UserService struct {
+	users repositories.UserRepository
+}
+
+func NewUserService(users repositories.UserRepository) *UserService {
+	return &UserService{users: users}
+}
+
+func (s *UserService) GetUser(ctx context.Context, id string) (*models.User, error) {
+	return s.users.GetUser(ctx, id)
 }
@@ -0,0 +1,31 @@
+// internal/tlsutil/redirect.go
+package tlsutil
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RedirectHandler redirects every plain HTTP request to the same URL over
+// HTTPS on httpsPort. 308 keeps the method and body of non-GET requests.
+func RedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 去掉请求中的端口，IPv6 地址需要去掉方括号后再拼接
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		switch {
+		case httpsPort != 443:
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,103 @@
+// internal/tlsutil/reloader.go
+package tlsutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay 是最后一次文件事件之后等待的时间，避免读到只写了一半的证书
+const reloadDelay = 200 * time.Millisecond
+
+// CertReloader serves a certificate loaded from a cert/key file pair and
+// reloads it when either file changes, so renewed certificates are picked up
+// without a restart. A pair that fails to load is logged and the previous
+// certificate keeps being served.
+type CertReloader struct {
+	certFile, keyFile string
+	watcher           *fsnotify.Watcher
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertReloader loads the certificate and starts watching its files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// 监听所在目录而不是文件本身，以便处理 Kubernetes secret 通过替换符号链接完成的更新
+	dirs := map[string]bool{filepath.Dir(certFile): true, filepath.Dir(keyFile): true}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	r.watcher = watcher
+	go r.watch()
+	return r, nil
+}
+
+func (r *CertReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *CertReloader) watch() {
+	var timer *time.Timer
+	for {
+		select {
+		case _, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(reloadDelay, func() {
+				if err := r.reload(); err != nil {
+					slog.Error("TLS certificate reload failed, keeping the current certificate", "error", err)
+					return
+				}
+				slog.Info("TLS certificate reloaded", "cert_file", r.certFile)
+			})
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("TLS certificate watcher error", "error", err)
+		}
+	}
+}
+
+// GetCertificate returns the current certificate. It is meant for
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Close stops watching the certificate files.
+func (r *CertReloader) Close() error {
+	return r.watcher.Close()
+}
@@ -0,0 +1,100 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCert(t *testing.T, certFile, keyFile, host string) {
+	t.Helper()
+	cert, err := SelfSigned([]string{host}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedHost(t *testing.T, r *CertReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.DNSNames[0]
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "old.example")
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got := servedHost(t, r); got != "old.example" {
+		t.Fatalf("served %s, want old.example", got)
+	}
+
+	// 无效的证书不会替换当前证书
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * reloadDelay)
+	if got := servedHost(t, r); got != "old.example" {
+		t.Fatalf("served %s after a broken write, want old.example", got)
+	}
+
+	writeCert(t, certFile, keyFile, "new.example")
+	deadline := time.Now().Add(5 * time.Second)
+	for servedHost(t, r) != "new.example" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		host, path string
+		port       int
+		want       string
+	}{
+		{"example.com", "/auth/google/login?x=1", 443, "https://example.com/auth/google/login?x=1"},
+		{"example.com:8080", "/", 8443, "https://example.com:8443/"},
+		{"[::1]:8080", "/a", 443, "https://[::1]/a"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		req.Host = tt.host
+		w := httptest.NewRecorder()
+		RedirectHandler(tt.port).ServeHTTP(w, req)
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s%s: %d %s, want %s", tt.host, tt.path, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
@@ -11,7 +11,20 @@ import (
 
 type SessionManager interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	SetXX(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
 	Get(ctx context.Context, key string, value interface{}) error
 	Delete(ctx context.Context, key string) error
+	AddToSet(ctx context.Context, key, member string) error
+	RemoveFromSet(ctx context.Context, key, member string) error
+	SetMembers(ctx context.Context, key string) ([]string, error)
+	CreateSession(ctx context.Context, token *oauth2.Token, userInfo map[string]interface{}) (string, error)
+	RotateSession(ctx context.Context, oldID string, token *oauth2.Token, userInfo map[string]interface{}) (string, error)
+	DeleteSession(ctx context.Context, sessionID string) error
 	GetSession(c *gin.Context) (*oauth2.Token, map[string]interface{}, error)
+	SetCookie(c *gin.Context, sessionID string)
+	ClearCookie(c *gin.Context)
+	CountSessions(ctx context.Context) (int, error)
+	Ping(ctx context.Context) error
+	Close() error
 }